@@ -0,0 +1,263 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// grafanaContext holds the settings needed to talk to one grafana instance/org
+type grafanaContext struct {
+	URL                   string `yaml:"url"`
+	APIKey                string `yaml:"apikey"`
+	Username              string `yaml:"username"`
+	Password              string `yaml:"password"`
+	OrgID                 int64  `yaml:"org-id"`
+	OrgName               string `yaml:"org-name"`
+	InsecureSkipTLSVerify bool   `yaml:"insecure-skip-tls-verify"`
+	CACert                string `yaml:"ca-cert"`
+}
+
+// authString returns the credentials in the form expected by client.NewClient
+func (g grafanaContext) authString() string {
+	if g.Username != "" {
+		return fmt.Sprintf("%s:%s", g.Username, g.Password)
+	}
+	return g.APIKey
+}
+
+// currentContextName returns the context selected with --context, or the
+// current-context from the config file
+func currentContextName() string {
+	if name := viper.GetString("context"); name != "" {
+		return name
+	}
+	return viper.GetString("current-context")
+}
+
+// getContexts reads all of the contexts from the config file
+func getContexts() (map[string]grafanaContext, error) {
+	return readContexts(viper.ConfigFileUsed())
+}
+
+// readContexts reads the contexts of a YAML config file. The file is read directly
+// rather than through viper, which lowercases keys and so the names of the contexts.
+func readContexts(path string) (map[string]grafanaContext, error) {
+	var config struct {
+		Contexts map[string]grafanaContext `yaml:"contexts"`
+	}
+	if path == "" {
+		return map[string]grafanaContext{}, nil
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read contexts from the config file: %w", err)
+	}
+	if err = yaml.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("unable to read contexts from the config file: %w", err)
+	}
+	if config.Contexts == nil {
+		config.Contexts = map[string]grafanaContext{}
+	}
+	return config.Contexts, nil
+}
+
+// getContext reads a single named context from the config file
+func getContext(name string) (grafanaContext, error) {
+	contexts, err := getContexts()
+	if err != nil {
+		return grafanaContext{}, err
+	}
+	settings, ok := contexts[name]
+	if !ok {
+		return grafanaContext{}, fmt.Errorf("context '%s' is not defined in the config file", name)
+	}
+	return settings, nil
+}
+
+// configCmd does not do anything, but is needed for scoping of subcommands
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the contexts in the grafanactl config file",
+	Long:  `Manage the contexts in the grafanactl config file`,
+}
+
+var getContextsCmd = &cobra.Command{
+	Use:   "get-contexts",
+	Short: "List the contexts in the config file",
+	Long:  `List the contexts in the config file`,
+	Run: func(cmd *cobra.Command, args []string) {
+		contexts, err := getContexts()
+		if err != nil {
+			exitWithError(err)
+		}
+		if len(contexts) == 0 {
+			fmt.Println("No contexts found.")
+			os.Exit(0)
+		}
+		names := make([]string, 0, len(contexts))
+		for name := range contexts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		current := currentContextName()
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Current", "Name", "URL", "Org"})
+		for _, name := range names {
+			marker := ""
+			if name == current {
+				marker = "*"
+			}
+			org := contexts[name].OrgName
+			if contexts[name].OrgID != 0 {
+				org = strconv.FormatInt(contexts[name].OrgID, 10)
+			}
+			table.Append([]string{marker, name, contexts[name].URL, org})
+		}
+		table.Render()
+	},
+}
+
+var useContextCmd = &cobra.Command{
+	Use:   "use-context <name>",
+	Short: "Set the current-context in the config file",
+	Long:  `Set the current-context in the config file`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := getContext(args[0]); err != nil {
+			exitWithError(err)
+		}
+		err := updateConfigFile(func(config map[interface{}]interface{}) {
+			config["current-context"] = args[0]
+		})
+		if err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("Switched to context '%s'.\n", args[0])
+	},
+}
+
+var setContextCmd = &cobra.Command{
+	Use:   "set-context <name>",
+	Short: "Create or modify a context in the config file",
+	Long: `Create or modify a context in the config file
+
+Only the settings which are specified are changed. The global --url,
+--apikey, --org-id and --org-name flags set the URL, credentials and
+organization of the context.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		err := updateConfigFile(func(config map[interface{}]interface{}) {
+			contexts, ok := config["contexts"].(map[interface{}]interface{})
+			if !ok {
+				contexts = map[interface{}]interface{}{}
+			}
+			context, ok := contexts[name].(map[interface{}]interface{})
+			if !ok {
+				context = map[interface{}]interface{}{}
+			}
+			flags := cmd.Flags()
+			for _, key := range []string{"url", "apikey", "username", "password", "ca-cert"} {
+				if flags.Changed(key) {
+					context[key], _ = flags.GetString(key)
+				}
+			}
+			// a context acts on a single organization, selected by ID or name
+			if flags.Changed("org-id") {
+				context["org-id"], _ = flags.GetInt64("org-id")
+				delete(context, "org-name")
+			}
+			if flags.Changed("org-name") {
+				context["org-name"], _ = flags.GetString("org-name")
+				delete(context, "org-id")
+			}
+			if flags.Changed("insecure-skip-tls-verify") {
+				context["insecure-skip-tls-verify"], _ = flags.GetBool("insecure-skip-tls-verify")
+			}
+			contexts[name] = context
+			config["contexts"] = contexts
+		})
+		if err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("Context '%s' saved.\n", name)
+	},
+}
+
+// updateConfigFile reads the YAML config file, lets update modify it, and writes it back.
+// The file is modified directly rather than through viper, so that settings
+// from flags and environment variables are not written to it.
+func updateConfigFile(update func(config map[interface{}]interface{})) error {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		if cfgFile != "" {
+			path = cfgFile
+		} else {
+			home, err := homedir.Dir()
+			if err != nil {
+				return err
+			}
+			path = filepath.Join(home, ".grafanactl.yaml")
+		}
+	}
+	if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+		return fmt.Errorf("only YAML config files can be modified, not %s", path)
+	}
+
+	config := map[interface{}]interface{}{}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	if err = yaml.Unmarshal(raw, &config); err != nil {
+		return fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+	update(config)
+	if raw, err = yaml.Marshal(config); err != nil {
+		return err
+	}
+	// the config file holds credentials, keep it private
+	if err = ioutil.WriteFile(path, raw, 0600); err != nil {
+		return fmt.Errorf("unable to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(getContextsCmd)
+	configCmd.AddCommand(useContextCmd)
+	configCmd.AddCommand(setContextCmd)
+
+	// url, apikey, org-id and org-name are inherited from the global flags
+	setContextCmd.Flags().String("username", "", "Username for basic authentication, instead of an API key")
+	setContextCmd.Flags().String("password", "", "Password for basic authentication")
+	setContextCmd.Flags().Bool("insecure-skip-tls-verify", false, "Don't verify the server's TLS certificate")
+	setContextCmd.Flags().String("ca-cert", "", "Path to a CA certificate used to verify the server")
+}
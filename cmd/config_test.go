@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadContextsMixedCase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grafanactl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".grafanactl.yaml")
+	config := `current-context: Prod
+contexts:
+  Prod:
+    url: https://grafana.your.domain
+    apikey: PRODKEY
+    org-id: 2
+  staging:
+    url: https://grafana.staging.your.domain
+    username: admin
+    password: secret
+    insecure-skip-tls-verify: true
+`
+	if err = ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	contexts, err := readContexts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contexts) != 2 {
+		t.Fatalf("got %d contexts, want 2: %v", len(contexts), contexts)
+	}
+	// names are kept as they are written, viper would have lowercased them
+	prod, ok := contexts["Prod"]
+	if !ok {
+		t.Fatalf("context 'Prod' not found in %v", contexts)
+	}
+	if prod.URL != "https://grafana.your.domain" || prod.authString() != "PRODKEY" || prod.OrgID != 2 {
+		t.Errorf("got %+v for context 'Prod'", prod)
+	}
+	if staging := contexts["staging"]; staging.authString() != "admin:secret" || !staging.InsecureSkipTLSVerify {
+		t.Errorf("got %+v for context 'staging'", staging)
+	}
+}
+
+func TestReadContextsWithoutConfigFile(t *testing.T) {
+	contexts, err := readContexts(filepath.Join(os.TempDir(), "grafanactl-missing.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contexts) != 0 {
+		t.Errorf("got %v, want no contexts", contexts)
+	}
+}
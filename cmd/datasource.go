@@ -0,0 +1,414 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/platform9/grafanactl/pkg/printer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// datasource command does not do anything, but is needed for scoping of subcommands
+var datasourceCmd = &cobra.Command{
+	Use:   "datasource",
+	Short: "Perform operations on Grafana Datasources",
+	Long: `Perform operations on Grafana Datasources
+
+Datasources are referenced by UID or name. Grafana versions before 7.0 don't
+have datasource UIDs, there datasources are only matched by name.`,
+}
+
+var datasourceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the datasources",
+	Long:  `List the datasources`,
+	Run: func(cmd *cobra.Command, args []string) {
+		requireAuthParams()
+		c := getGrafanaClient()
+		datasources, err := c.GetAllDataSourcesWithContext(commandContext())
+		if err != nil {
+			exitWithError(err)
+		}
+		printList(dataSourceList(datasources))
+	},
+}
+
+var datasourceGetCmd = &cobra.Command{
+	Use:   "get <uid|name>",
+	Short: "Show a datasource",
+	Long: `Show a datasource
+
+Grafana does not return the values of secure fields, they are listed in secureJsonFields.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireAuthParams()
+		c := getGrafanaClient()
+		ds := findDataSource(commandContext(), c, args[0])
+		printList(dataSourceList{ds})
+	},
+}
+
+var datasourceDeleteCmd = &cobra.Command{
+	Use:   "delete <uid|name>",
+	Short: "Delete a datasource",
+	Long:  `Delete a datasource`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireAuthParams()
+		ctx := commandContext()
+		c := getGrafanaClient()
+		ds := findDataSource(ctx, c, args[0])
+		if err := c.DeleteDataSourceWithContext(ctx, ds.ID); err != nil {
+			exitWithError(fmt.Errorf("unable to delete datasource %s: %w", ds.Name, err))
+		}
+		fmt.Printf("Deleted datasource %s\n", ds.Name)
+	},
+}
+
+var datasourceDownloadCmd = &cobra.Command{
+	Use:   "download [<uid|name>...]",
+	Short: "Download datasources",
+	Long: `Download datasources
+
+Every datasource is saved to a JSON file named after it, in the target dir.
+Without arguments, every datasource is downloaded.
+
+The values of secure fields, such as passwords, are never written to the files.
+They are replaced by placeholders like ${PROMETHEUS_BASIC_AUTH_PASSWORD}, which
+are filled in by 'datasource upload'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		requireAuthParams()
+		ctx := commandContext()
+		c := getGrafanaClient()
+		target := viper.GetString("target")
+
+		var datasources []client.GrafanaDataSource
+		if len(args) == 0 {
+			all, err := c.GetAllDataSourcesWithContext(ctx)
+			if err != nil {
+				exitWithError(err)
+			}
+			for _, ds := range all {
+				full, err := c.GetDataSourceWithContext(ctx, ds.ID)
+				if err != nil {
+					exitWithError(fmt.Errorf("unable to get datasource %s: %w", ds.Name, err))
+				}
+				datasources = append(datasources, full)
+			}
+		}
+		for _, ref := range args {
+			datasources = append(datasources, findDataSource(ctx, c, ref))
+		}
+
+		if err := os.MkdirAll(target, 0744); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating directory %s: %s\n", target, err)
+			os.Exit(exitError)
+		}
+		for _, ds := range datasources {
+			raw, _ := json.MarshalIndent(exportDataSource(ds), "", "  ")
+			path := filepath.Join(target, sanitizeDirectoryName(ds.Name)+".json")
+			if err := ioutil.WriteFile(path, raw, 0666); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing %s: %s\n", path, err)
+				os.Exit(exitError)
+			}
+			fmt.Printf("Downloaded %s\n", path)
+		}
+	},
+}
+
+var datasourceUploadCmd = &cobra.Command{
+	Use:   "upload",
+	Short: "Upload datasources",
+	Long: `Upload datasources
+
+Only files with a '.json' extension are uploaded. Datasources are matched with
+grafana by UID, or by name, and are created or updated.
+
+Placeholders like ${NAME} in the secure fields are filled in from the environment
+variable NAME, or from a YAML or JSON file of names and values given with --secrets.
+Environment variables take precedence. Nothing is uploaded if a placeholder has no value.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		datasources, err := readDataSourceFiles(viper.GetString("files"))
+		if err != nil {
+			exitWithError(err)
+		}
+		secrets, err := readSecretsFile(viper.GetString("secrets"))
+		if err != nil {
+			exitWithError(err)
+		}
+		var missing []string
+		for i := range datasources {
+			missing = append(missing, expandDataSourceSecrets(&datasources[i], secrets)...)
+		}
+		if len(missing) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: no value for %s. Set them in the environment, or in the --secrets file.\n", strings.Join(missing, ", "))
+			os.Exit(exitError)
+		}
+
+		requireAuthParams()
+		ctx := commandContext()
+		c := getGrafanaClient()
+		remote, err := c.GetAllDataSourcesWithContext(ctx)
+		if err != nil {
+			exitWithError(err)
+		}
+		var failures failureReport
+		for _, ds := range datasources {
+			existing, found := matchDataSource(remote, ds)
+			if !found {
+				if _, err := c.CreateDataSourceWithContext(ctx, ds); err != nil {
+					failures.addf("Error creating datasource %s: %w", ds.Name, err)
+					continue
+				}
+				fmt.Printf("Datasource %s created\n", ds.Name)
+				continue
+			}
+			ds.ID = existing.ID
+			if err := c.UpdateDataSourceWithContext(ctx, ds); err != nil {
+				failures.addf("Error updating datasource %s: %w", ds.Name, err)
+				continue
+			}
+			fmt.Printf("Datasource %s updated\n", ds.Name)
+		}
+		failures.print(os.Stderr)
+		if failures.len() > 0 {
+			os.Exit(failures.exitCode())
+		}
+	},
+}
+
+// findDataSource gets the full settings of a datasource by UID or name, and exits if it is not found
+func findDataSource(ctx context.Context, c *client.Client, ref string) client.GrafanaDataSource {
+	datasources, err := c.GetAllDataSourcesWithContext(ctx)
+	if err != nil {
+		exitWithError(err)
+	}
+	ds, found := lookupDataSource(datasources, ref)
+	if !found {
+		fmt.Fprintf(os.Stderr, "Error: datasource '%s' was not found.\n", ref)
+		os.Exit(exitNotFound)
+	}
+	full, err := c.GetDataSourceWithContext(ctx, ds.ID)
+	if err != nil {
+		exitWithError(fmt.Errorf("unable to get datasource %s: %w", ds.Name, err))
+	}
+	return full
+}
+
+// matchDataSource finds the datasource in grafana that a local datasource is uploaded to.
+// Datasources are matched by UID, and by name if either has no UID.
+func matchDataSource(remote []client.GrafanaDataSource, local client.GrafanaDataSource) (client.GrafanaDataSource, bool) {
+	if local.UID != "" {
+		for _, ds := range remote {
+			if ds.UID == local.UID {
+				return ds, true
+			}
+		}
+	}
+	for _, ds := range remote {
+		if ds.Name == local.Name && (ds.UID == "" || local.UID == "") {
+			return ds, true
+		}
+	}
+	return client.GrafanaDataSource{}, false
+}
+
+// exportDataSource removes the instance specific fields of a datasource,
+// and replaces the values of its secure fields by placeholders
+func exportDataSource(ds client.GrafanaDataSource) client.GrafanaDataSource {
+	ds.ID = 0
+	ds.OrgID = 0
+	ds.Version = 0
+	ds.ReadOnly = false
+	ds.TypeName = ""
+	if ds.Password != "" {
+		ds.Password = secretPlaceholder(ds.Name, "password")
+	}
+	if ds.BasicAuthPassword != "" {
+		ds.BasicAuthPassword = secretPlaceholder(ds.Name, "basicAuthPassword")
+	}
+	ds.SecureJSONData = nil
+	for field, set := range ds.SecureJSONFields {
+		if !set {
+			continue
+		}
+		if ds.SecureJSONData == nil {
+			ds.SecureJSONData = map[string]string{}
+		}
+		ds.SecureJSONData[field] = secretPlaceholder(ds.Name, field)
+	}
+	ds.SecureJSONFields = nil
+	return ds
+}
+
+var (
+	nonAlphanumericRegex = regexp.MustCompile("[^A-Za-z0-9]+")
+	camelCaseRegex       = regexp.MustCompile("([a-z0-9])([A-Z])")
+	placeholderRegex     = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// secretPlaceholder names the variable of a secure field after the datasource and the field,
+// e.g. ${PROMETHEUS_BASIC_AUTH_PASSWORD}
+func secretPlaceholder(name, field string) string {
+	variable := camelCaseRegex.ReplaceAllString(name+"_"+field, "${1}_${2}")
+	variable = strings.Trim(nonAlphanumericRegex.ReplaceAllString(variable, "_"), "_")
+	return fmt.Sprintf("${%s}", strings.ToUpper(variable))
+}
+
+// expandDataSourceSecrets fills in the placeholders of the secure fields of a datasource,
+// from the environment or the secrets. Returns the names of placeholders without a value.
+func expandDataSourceSecrets(ds *client.GrafanaDataSource, secrets map[string]string) []string {
+	var missing []string
+	expand := func(value string) string {
+		return placeholderRegex.ReplaceAllStringFunc(value, func(placeholder string) string {
+			name := placeholderRegex.FindStringSubmatch(placeholder)[1]
+			if value, ok := os.LookupEnv(name); ok {
+				return value
+			}
+			if value, ok := secrets[name]; ok {
+				return value
+			}
+			missing = append(missing, name)
+			return placeholder
+		})
+	}
+	ds.Password = expand(ds.Password)
+	ds.BasicAuthPassword = expand(ds.BasicAuthPassword)
+	for field, value := range ds.SecureJSONData {
+		ds.SecureJSONData[field] = expand(value)
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// readSecretsFile reads a YAML or JSON file of placeholder names and values
+func readSecretsFile(path string) (map[string]string, error) {
+	secrets := map[string]string{}
+	if path == "" {
+		return secrets, nil
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(raw, &secrets); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+	return secrets, nil
+}
+
+// readDataSourceFiles reads the datasources in a file, or in the JSON files of a directory.
+// Files that are not datasources are reported and skipped.
+func readDataSourceFiles(root string) ([]client.GrafanaDataSource, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{root}
+	if info.IsDir() {
+		if paths, err = filepath.Glob(filepath.Join(root, "*.json")); err != nil {
+			return nil, err
+		}
+	}
+	var datasources []client.GrafanaDataSource
+	for _, path := range paths {
+		if !strings.HasSuffix(path, ".json") {
+			fmt.Printf("Skipping '%s' (Not a JSON file)\n", path)
+			continue
+		}
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read file %s: %s", path, err)
+		}
+		var ds client.GrafanaDataSource
+		if err = json.Unmarshal(raw, &ds); err != nil || ds.Name == "" || ds.Type == "" {
+			fmt.Printf("Skipping '%s' (Not a datasource)\n", path)
+			continue
+		}
+		datasources = append(datasources, ds)
+	}
+	return datasources, nil
+}
+
+// dataSourceList prints datasources
+type dataSourceList []client.GrafanaDataSource
+
+func (l dataSourceList) Columns() []printer.Column {
+	return []printer.Column{
+		{Header: "Id"},
+		{Header: "UID"},
+		{Header: "Name"},
+		{Header: "Type"},
+		{Header: "URL"},
+		{Header: "Default"},
+		{Header: "Access", Wide: true},
+		{Header: "Database", Wide: true},
+		{Header: "Read Only", Wide: true},
+	}
+}
+
+func (l dataSourceList) Len() int {
+	return len(l)
+}
+
+func (l dataSourceList) Row(i int) []string {
+	ds := l[i]
+	return []string{
+		strconv.FormatInt(ds.ID, 10),
+		ds.UID,
+		ds.Name,
+		ds.Type,
+		ds.URL,
+		strconv.FormatBool(ds.IsDefault),
+		ds.Access,
+		ds.Database,
+		strconv.FormatBool(ds.ReadOnly),
+	}
+}
+
+func (l dataSourceList) Name(i int) string {
+	return l[i].Name
+}
+
+func (l dataSourceList) Items() interface{} {
+	return []client.GrafanaDataSource(l)
+}
+
+func init() {
+	rootCmd.AddCommand(datasourceCmd)
+	datasourceCmd.AddCommand(datasourceListCmd)
+	datasourceCmd.AddCommand(datasourceGetCmd)
+	datasourceCmd.AddCommand(datasourceDeleteCmd)
+	datasourceCmd.AddCommand(datasourceDownloadCmd)
+	datasourceCmd.AddCommand(datasourceUploadCmd)
+
+	datasourceDownloadCmd.Flags().StringP("target", "t", ".", "Target directory to save datasource files.")
+	datasourceUploadCmd.Flags().StringP("files", "f", ".", "Target file or directory of datasource files to upload.")
+	datasourceUploadCmd.Flags().String("secrets", "", "YAML or JSON file with the values of secret placeholders")
+}
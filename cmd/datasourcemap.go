@@ -0,0 +1,109 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/platform9/grafanactl/pkg/dashboard"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// dataSourceMapper rewrites the datasource references of dashboards to the datasources
+// of the instance they are uploaded to. References are resolved by name or UID, after
+// replacing them with the entries of the --datasource-map file.
+type dataSourceMapper struct {
+	// mapping maps datasource names or UIDs to the names or UIDs they are replaced with
+	mapping map[string]string
+	// targets are the datasources of the instance, nil if they can't be listed
+	targets []client.GrafanaDataSource
+	// sources are the datasources of the instance the dashboards are copied from, if any.
+	// UIDs which don't exist in the target instance are resolved by the name of the source datasource.
+	sources []client.GrafanaDataSource
+}
+
+// newDataSourceMapper reads the --datasource-map file, and lists the datasources of c
+func newDataSourceMapper(ctx context.Context, c *client.Client) (*dataSourceMapper, error) {
+	m := &dataSourceMapper{mapping: map[string]string{}}
+	if path := viper.GetString("datasource-map"); path != "" {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = yaml.Unmarshal(raw, &m.mapping); err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+		}
+	}
+	targets, err := c.GetAllDataSourcesWithContext(ctx)
+	switch {
+	case client.IsForbidden(err), client.IsUnauthorized(err):
+		// listing datasources requires the Admin role of the organization
+		fmt.Fprintln(os.Stderr, "Warning: not allowed to list the datasources, datasource references are not checked.")
+	case err != nil:
+		return nil, fmt.Errorf("unable to list the datasources: %w", err)
+	default:
+		m.targets = append([]client.GrafanaDataSource{}, targets...)
+	}
+	return m, nil
+}
+
+// rewrite resolves the datasource references of a dashboard, and returns those that can't be resolved
+func (m *dataSourceMapper) rewrite(dash map[string]interface{}) []dashboard.UnresolvedDataSource {
+	return dashboard.RewriteDataSources(dash, m.resolve)
+}
+
+func (m *dataSourceMapper) resolve(ref dashboard.DataSourceRef) (dashboard.DataSourceRef, bool) {
+	mapped, ok := m.mapping[ref.UID]
+	if !ok {
+		mapped, ok = m.mapping[ref.Name]
+	}
+	if !ok {
+		mapped = ref.String()
+		if _, found := lookupDataSource(m.targets, mapped); !found && ref.UID != "" {
+			if source, found := lookupDataSource(m.sources, ref.UID); found {
+				mapped = source.Name
+			}
+		}
+	}
+
+	// without the datasources of the instance, the mapping is applied as it is
+	if m.targets == nil {
+		if ref.UID != "" {
+			return dashboard.DataSourceRef{UID: mapped, Type: ref.Type}, true
+		}
+		return dashboard.DataSourceRef{Name: mapped}, true
+	}
+	ds, found := lookupDataSource(m.targets, mapped)
+	if !found {
+		return ref, false
+	}
+	return dashboard.DataSourceRef{Name: ds.Name, UID: ds.UID, Type: ds.Type}, true
+}
+
+// lookupDataSource finds a datasource by UID or name
+func lookupDataSource(datasources []client.GrafanaDataSource, ref string) (client.GrafanaDataSource, bool) {
+	for _, ds := range datasources {
+		if (ds.UID != "" && ds.UID == ref) || ds.Name == ref {
+			return ds, true
+		}
+	}
+	return client.GrafanaDataSource{}, false
+}
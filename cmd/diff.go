@@ -0,0 +1,287 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/platform9/grafanactl/pkg/dashboard"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Exit codes of the diff command, following the conventions of diff(1)
+const (
+	diffExitDrift = 1
+	diffExitError = 2
+)
+
+// diffCmd compares dashboards between local files and grafana, or two contexts
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare dashboards with a grafana instance",
+	Long: `Compare dashboards with a grafana instance
+
+By default, the local files are compared with the grafana instance of the
+current context. Use --from and --to to compare two contexts instead.
+
+Dashboards are matched by UID, and compared without their id and version.
+Both sides are normalized with --strip and --renumber-panels first, like
+'dashboard download' normalizes the files, so a fresh download has no drift.
+The placeholders of local files are replaced with --values and --set first,
+like 'dashboard upload' does.
+The command exits with status 1 when differences are found, and 2 on errors.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			from, to dashboardSet
+			err      error
+		)
+		ctx := commandContext()
+		format := viper.GetString("format")
+		if format != "structural" && format != "unified" {
+			fmt.Fprintf(os.Stderr, "Error: unknown format '%s', must be structural or unified.\n", format)
+			os.Exit(diffExitError)
+		}
+
+		fromContext := viper.GetString("from")
+		toContext := viper.GetString("to")
+		if fromContext != "" || toContext != "" {
+			if fromContext == "" || toContext == "" {
+				fmt.Fprintln(os.Stderr, "Error: both --from and --to must be specified.")
+				os.Exit(diffExitError)
+			}
+			if from, err = contextDashboardSet(ctx, fromContext); err == nil {
+				to, err = contextDashboardSet(ctx, toContext)
+			}
+		} else {
+			requireAuthParams()
+			if to, err = localDashboardSet(cmd, viper.GetString("files")); err == nil {
+				// only fetch the dashboards of a single file, but everything for a directory
+				var uids []string
+				if info, _ := os.Stat(viper.GetString("files")); info != nil && info.Mode().IsRegular() {
+					uids = to.uids()
+				}
+				name := currentContextName()
+				if name == "" {
+					name = "grafana"
+				}
+				from, err = remoteDashboardSet(ctx, getGrafanaClient(), name, uids)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(diffExitError)
+		}
+
+		if drift := printDashboardDiff(from, to, format, normalizeOptions()); drift > 0 {
+			fmt.Printf("%d dashboards differ.\n", drift)
+			os.Exit(diffExitDrift)
+		}
+		fmt.Println("No differences found.")
+	},
+}
+
+// dashboardSet holds the dashboards of one side of a diff, by UID
+type dashboardSet struct {
+	name       string
+	dashboards map[string]diffEntry
+}
+
+// diffEntry is a dashboard to be compared, and where it came from
+type diffEntry struct {
+	location string
+	title    string
+	folder   string
+	contents map[string]interface{}
+}
+
+func (s dashboardSet) uids() []string {
+	uids := make([]string, 0, len(s.dashboards))
+	for uid := range s.dashboards {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+	return uids
+}
+
+// localDashboardSet reads the dashboards in a local file or directory,
+// with the Jsonnet and values flags of cmd
+func localDashboardSet(cmd *cobra.Command, root string) (dashboardSet, error) {
+	set := dashboardSet{name: root, dashboards: map[string]diffEntry{}}
+	opts, err := jsonnetOptionsFromFlags(cmd)
+	if err != nil {
+		return set, err
+	}
+	folders, skipped, err := readLocalTree(root, opts)
+	if err != nil {
+		return set, err
+	}
+	for _, err := range skipped {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+	}
+	values, err := readValues(cmd)
+	if err != nil {
+		return set, err
+	}
+	if err = renderLocalTree(folders, values); err != nil {
+		return set, err
+	}
+	for _, fol := range folders {
+		folderTitle := "General"
+		if fol.folder != nil {
+			folderTitle = fol.folder.Title
+		}
+		for _, dash := range fol.dashboards {
+			// dashboards without a UID can't be matched, but they are still drift
+			key := dash.uid()
+			if key == "" {
+				key = dash.path
+			}
+			set.dashboards[key] = diffEntry{
+				location: dash.path,
+				title:    dash.title(),
+				folder:   folderTitle,
+				contents: dash.contents,
+			}
+		}
+	}
+	return set, nil
+}
+
+// contextDashboardSet downloads every dashboard of a named context
+func contextDashboardSet(ctx context.Context, name string) (dashboardSet, error) {
+	c, err := getGrafanaClientForContext(name)
+	if err != nil {
+		return dashboardSet{}, err
+	}
+	return remoteDashboardSet(ctx, c, name, nil)
+}
+
+// remoteDashboardSet downloads dashboards from grafana.
+// If no UIDs are given, every dashboard is downloaded.
+func remoteDashboardSet(ctx context.Context, c *client.Client, name string, uids []string) (dashboardSet, error) {
+	set := dashboardSet{name: name, dashboards: map[string]diffEntry{}}
+	if uids == nil {
+		results, err := c.SearchAllDashboardsWithContext(ctx, url.Values{})
+		if err != nil {
+			return set, fmt.Errorf("error searching dashboards in %s: %w", name, err)
+		}
+		for _, hit := range results {
+			uids = append(uids, hit.UID)
+		}
+	}
+	for _, uid := range uids {
+		dash, err := c.GetDashboardWithContext(ctx, uid)
+		if client.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return set, fmt.Errorf("error downloading dashboard %s from %s: %w", uid, name, err)
+		}
+		var contents map[string]interface{}
+		raw, _ := dash.Dashboard.MarshalJSON()
+		if err = json.Unmarshal(raw, &contents); err != nil {
+			return set, err
+		}
+		folderTitle := dash.Meta.FolderTitle
+		if dash.Meta.FolderId == 0 {
+			folderTitle = "General"
+		}
+		set.dashboards[uid] = diffEntry{
+			location: fmt.Sprintf("%s/%s", name, uid),
+			title:    fmt.Sprintf("%v", contents["title"]),
+			folder:   folderTitle,
+			contents: contents,
+		}
+	}
+	return set, nil
+}
+
+// printDashboardDiff prints the differences between two sets of dashboards,
+// once both are normalized with opts, and returns how many dashboards differ
+func printDashboardDiff(from, to dashboardSet, format string, opts dashboard.NormalizeOptions) int {
+	drift := 0
+	uids := mergeStringSlices(from.uids(), to.uids())
+	sort.Strings(uids)
+	for _, uid := range uids {
+		fromDash, inFrom := from.dashboards[uid]
+		toDash, inTo := to.dashboards[uid]
+		switch {
+		case !inTo:
+			fmt.Printf("- %s (%s): only in %s\n", fromDash.title, uid, from.name)
+			drift++
+			continue
+		case !inFrom:
+			fmt.Printf("+ %s (%s): only in %s\n", toDash.title, uid, to.name)
+			drift++
+			continue
+		}
+
+		fromContents := comparableDashboard(fromDash.contents, opts)
+		toContents := comparableDashboard(toDash.contents, opts)
+		if reflect.DeepEqual(fromContents, toContents) && fromDash.folder == toDash.folder {
+			continue
+		}
+		drift++
+		fmt.Printf("~ %s (%s): %s -> %s\n", toDash.title, uid, fromDash.location, toDash.location)
+		if fromDash.folder != toDash.folder {
+			fmt.Printf("    moved from folder '%s' to '%s'\n", fromDash.folder, toDash.folder)
+		}
+		if format == "unified" {
+			unified, err := dashboard.UnifiedDiff(fromContents, toContents, fromDash.location, toDash.location)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to diff %s: %s\n", uid, err)
+				continue
+			}
+			fmt.Print(unified)
+			continue
+		}
+		panels := dashboard.DiffPanels(fromContents, toContents)
+		if len(panels.Added) > 0 {
+			fmt.Printf("    panels added: %s\n", strings.Join(panels.Added, ", "))
+		}
+		if len(panels.Removed) > 0 {
+			fmt.Printf("    panels removed: %s\n", strings.Join(panels.Removed, ", "))
+		}
+		if len(panels.Changed) > 0 {
+			fmt.Printf("    panels changed: %s\n", strings.Join(panels.Changed, ", "))
+		}
+		for _, change := range dashboard.Diff(fromContents, toContents) {
+			fmt.Printf("    %s\n", change)
+		}
+	}
+	return drift
+}
+
+func init() {
+	dashboardCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringP("files", "f", ".", "Local file or directory of dashboard files to compare.")
+	diffCmd.Flags().String("from", "", "Name of a context to compare, instead of local files")
+	diffCmd.Flags().String("to", "", "Name of the context to compare --from with")
+	diffCmd.Flags().String("format", "structural", "How differences are printed: structural or unified")
+	addJsonnetFlags(diffCmd)
+	addNormalizeFlags(diffCmd)
+	addValuesFlags(diffCmd)
+	viper.BindPFlags(diffCmd.Flags())
+}
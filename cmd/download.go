@@ -16,6 +16,7 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -27,132 +28,458 @@ import (
 	"strings"
 
 	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/platform9/grafanactl/pkg/dashboard"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 // downloadCmd represents the download command
 var downloadCmd = &cobra.Command{
-	Use:   "download",
+	Use:   "download [uid...]",
 	Short: "Download dashboards from a grafana instance",
-	Long:  `Download dashboards from a grafana instance`,
-	// allow specification of dashboard ID as a positional argument
+	Long: `Download dashboards from a grafana instance
+
+Dashboards can be selected by UID as positional arguments, or by using the
+--tag, --folder and --query selectors. Use --all to download every dashboard.
+
+With --all-orgs, every dashboard of every organization is downloaded. Each
+organization is saved to a directory named after it, under the target dir.
+
+With --git-commit, the changed, added and removed files under the target dir
+are committed to the git repository it is in, once everything is downloaded.
+By default every dashboard is committed on its own, authored by the user who
+last updated it in grafana, at that time. With --git-commit-mode single, all
+changes are committed at once. With --all or --all-orgs, the dashboard files of
+dashboards which were deleted in grafana are removed and committed as well.
+The commit is refused if the git index already has staged changes.
+
+With --portable, dashboards are saved like grafana's "Export for sharing
+externally": datasource references become ${DS_NAME} inputs listed in
+__inputs, and the plugins the dashboard uses are listed in __requires.
+Upload them to another instance with 'dashboard upload --inputs'.`,
+	// allow specification of dashboard UIDs as positional arguments
 	// except do not error out if `--all` is set and no positional arg is specified
 	Run: func(cmd *cobra.Command, args []string) {
 		requireAuthParams()
-		if !viper.GetBool("all") {
-			// expect the user to have specified a positional argument
-			if len(args) < 1 {
-				fmt.Fprintln(os.Stderr, "You must specify a dashboard ID or use --all.")
-				os.Exit(1)
-			} else {
-				fmt.Println("Individual dashboard download not implemented. try --all.")
-			}
-		} else {
-			var (
-				folders []client.GrafanaFolder
-				err     error
-				c       *client.Client
-			)
-			c = getGrafanaClient()
-
-			// Prepare folder destinations
-			if folders, err = c.GetAllFolders(); err != nil {
-				fmt.Fprintf(os.Stderr, fmt.Sprintf("error downloading folders: %s\n", err))
-				os.Exit(1)
+		ctx := commandContext()
+		c := getGrafanaClient()
+		d := newDownloader(c)
+		target := viper.GetString("target")
+		if mode := viper.GetString("git-commit-mode"); viper.GetBool("git-commit") && mode != gitCommitPerDashboard && mode != gitCommitSingle {
+			fmt.Fprintf(os.Stderr, "Error: unknown --git-commit-mode '%s', must be per-dashboard or single.\n", mode)
+			os.Exit(exitError)
+		}
+
+		switch {
+		case viper.GetBool("all-orgs"):
+			orgs, err := c.GetAllOrgsWithContext(ctx)
+			if err != nil {
+				exitWithError(fmt.Errorf("error listing organizations: %w", err))
 			}
-			for _, fol := range folders {
-				// Sanitize the folder name
-				sanitizeRegex, _ := regexp.Compile("[^A-Za-z0-9._-]")
-				dirName := strings.ToLower(fol.Title)
-				dirName = string(sanitizeRegex.ReplaceAll([]byte(dirName), []byte("_")))
-				dirName = filepath.Join(viper.GetString("target"), dirName)
-				signatureFile := filepath.Join(dirName, ".folder.json")
-
-				// Check if a folder already exists
-				exists, _ := os.Lstat(dirName)
-				if exists == nil {
-					// Attempt to create the directory
-					err := os.MkdirAll(dirName, 0744)
-					if err != nil {
-						fmt.Fprintf(os.Stderr, "Error creating directory %s: %s\n", dirName, err)
-						continue
-					}
-					// Save the folder signature into the directory
-					var fileContents []byte
-					fileContents, err = json.Marshal(fol)
-					if err != nil {
-						fmt.Fprintf(os.Stderr, fmt.Sprintf("Unable to marshal json: %v\nError: %s", fol, err))
-						continue
-					}
-					if err = ioutil.WriteFile(signatureFile, fileContents, 0666); err != nil {
-						fmt.Fprintf(os.Stderr, fmt.Sprintf("Error writing %s: %s\n", signatureFile, err))
-						continue
-					}
-					saveFolderDashboards(fol.ID, dirName)
-				} else {
-					// Read the .folder.json file and unmarshal it
-					var directoryIsFolder bool
-					if directoryIsFolder, err = isDirectoryMatch(fol, dirName); err != nil {
-						fmt.Fprintf(os.Stderr, "%s", err)
-						continue
-					}
-					if directoryIsFolder {
-						fmt.Printf("Existing directory '%s' matches the existing grafana folder '%s'. Overwriting.\n", dirName, fol.Title)
-						saveFolderDashboards(fol.ID, dirName)
-					} else {
-						fmt.Println("Folder signatures don't match")
-						fmt.Printf("The folder '%s' will be skipped\n", fol.Title)
-						// TODO: append the UID to the folder name and try again
-					}
+			for _, org := range orgs {
+				if ctx.Err() != nil {
+					break
+				}
+				// every organization is saved to its own directory
+				orgDir := filepath.Join(target, sanitizeDirectoryName(org.Name))
+				if err = os.MkdirAll(orgDir, 0744); err != nil {
+					d.failures.addf("Error creating directory %s: %s", orgDir, err)
 					continue
 				}
+				fmt.Printf("Downloading organization %s (%d) to %s\n", org.Name, org.ID, orgDir)
+				c.SetOrgID(org.ID)
+				d.all(ctx, orgDir)
+			}
+		case viper.GetBool("all"):
+			d.all(ctx, target)
+		default:
+			// expect the user to have specified a positional argument or a selector
+			selectors := getSearchParams(cmd, nil)
+			if len(args) < 1 && len(selectors) == 0 {
+				fmt.Fprintln(os.Stderr, "You must specify a dashboard UID, a selector (--tag, --folder, --query) or use --all.")
+				os.Exit(exitError)
+			}
+			uids := args
+			if len(selectors) > 0 {
+				results, err := c.SearchAllDashboardsWithContext(ctx, selectors)
+				if err != nil {
+					exitWithError(fmt.Errorf("error searching dashboards: %w", err))
+				}
+				for _, hit := range results {
+					uids = mergeStringSlices(uids, []string{hit.UID})
+				}
+			}
+			folders, err := c.GetAllFoldersWithContext(ctx)
+			if err != nil {
+				exitWithError(fmt.Errorf("error downloading folders: %w", err))
 			}
-			// Download all of the dashboards in the "General" folder (always has ID of 0)
-			saveFolderDashboards(0, viper.GetString("target"))
+			d.dashboards(ctx, uids, d.directories(ctx, target, folders))
 		}
+		if viper.GetBool("git-commit") && d.failures.len() == 0 && ctx.Err() == nil {
+			prune := viper.GetBool("all") || viper.GetBool("all-orgs")
+			if err := commitDownload(target, d.saved, viper.GetString("git-commit-mode"), prune); err != nil {
+				d.failures.addf("Unable to commit the downloaded dashboards: %w", err)
+			}
+		}
+		d.report(ctx)
 	},
 }
 
-// saveFolderDashboards will download all of the dashboards to the target dir
-// It's expected that a folder with this ID and the target dir already exist
-func saveFolderDashboards(folderID int64, targetDir string) error {
-	var (
-		query     url.Values
-		results   []client.GrafanaSearchHit
-		rawBoard  []byte
-		dash      client.GrafanaDashboardFullWithMeta
-		err       error
-		folderIDs string
-	)
-	folderIDs = strconv.FormatInt(folderID, 10)
-	c := getGrafanaClient()
-	query = url.Values{}
-	query.Add("folderIds", folderIDs)
-	if results, err = c.SearchDashboards(query); err != nil {
-		return fmt.Errorf("error searching dashboards in folder %s: %w", folderIDs, err)
+// downloader holds the settings and results of a download
+type downloader struct {
+	c        *client.Client
+	parallel int
+	// permissions saves the permissions of every folder to a .permissions.json file
+	permissions bool
+	// format is the format of dashboard files, json or yaml
+	format    string
+	normalize dashboard.NormalizeOptions
+	// portable saves dashboards in the format of grafana's "Export for sharing externally"
+	portable bool
+	exporter *portableExporter
+
+	failures   failureReport
+	downloaded int
+	total      int
+	// saved are the dashboard files written, in order
+	saved []savedDashboard
+}
+
+// savedDashboard is a dashboard file written by a download
+type savedDashboard struct {
+	path  string
+	uid   string
+	title string
+	meta  client.GrafanaDashboardMeta
+}
+
+// newDownloader reads the settings of a download from the flags
+func newDownloader(c *client.Client) *downloader {
+	format := viper.GetString("format")
+	if format != formatJSON && format != formatYAML {
+		fmt.Fprintf(os.Stderr, "Error: unknown format '%s', must be json or yaml.\n", format)
+		os.Exit(exitError)
 	}
-	for _, board := range results {
-		// Download the dashboard
-		if dash, err = c.GetDashboard(board.UID); err != nil {
-			fmt.Fprintf(os.Stderr, fmt.Sprintf("error downloading dashboard %s: %s\n", board.UID, err))
+	return &downloader{
+		c:           c,
+		parallel:    getParallel(),
+		permissions: viper.GetBool("permissions"),
+		format:      format,
+		normalize:   normalizeOptions(),
+		portable:    viper.GetBool("portable"),
+	}
+}
+
+// report prints the errors of a download, and exits if it was interrupted or failed
+func (d *downloader) report(ctx context.Context) {
+	d.failures.print(os.Stderr)
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Download interrupted after %d dashboards were downloaded.\n", d.downloaded)
+		os.Exit(exitError)
+	}
+	if d.failures.len() > 0 {
+		fmt.Fprintf(os.Stderr, "Downloaded %d of %d dashboards.\n", d.downloaded, d.total)
+		os.Exit(d.failures.exitCode())
+	}
+}
+
+// all downloads every folder and dashboard of the organization of the client to root
+func (d *downloader) all(ctx context.Context, root string) {
+	folders, err := d.c.GetAllFoldersWithContext(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.failures.addf("error downloading folders: %w", err)
+		}
+		return
+	}
+	// including the dashboards in the "General" folder
+	d.folders(ctx, root, folders, true)
+}
+
+// folder downloads a folder, the folders nested in it and their dashboards to a directory under root
+func (d *downloader) folder(ctx context.Context, root string, fol client.GrafanaFolder) {
+	nested, err := d.c.GetNestedFoldersWithContext(ctx, fol.UID)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.failures.addf("error downloading the folders in %s: %w", fol.UID, err)
+		}
+		return
+	}
+	d.folders(ctx, root, append([]client.GrafanaFolder{fol}, nested...), false)
+}
+
+// folders downloads folders and their dashboards to root, and the dashboards of the
+// "General" folder if general is set. Nested folders are saved to the directory of
+// their parent, every folder gets a directory, even if it holds no dashboards.
+func (d *downloader) folders(ctx context.Context, root string, folders []client.GrafanaFolder, general bool) {
+	var uids []string
+	dirs := d.directories(ctx, root, folders)
+	for _, fol := range folders {
+		if ctx.Err() != nil {
+			break
+		}
+		if _, err := dirs.get(fol.ID); err != nil {
+			d.failures.add(err)
 			continue
 		}
-		rawBoard, _ = dash.Dashboard.Encode()
-		// Write the dashboard to file
-		path := filepath.Join(targetDir, fmt.Sprintf("%s.json", dash.Meta.Slug))
-		if err = ioutil.WriteFile(path, rawBoard, 0666); err != nil {
-			fmt.Fprintf(os.Stderr, fmt.Sprintf("error writing: %s\n", err))
+		folderUIDs, err := searchFolderDashboards(ctx, d.c, fol.ID)
+		if err != nil {
+			if ctx.Err() == nil {
+				d.failures.add(err)
+			}
 			continue
 		}
-		fmt.Printf("Downloaded %s\n", path)
+		uids = append(uids, folderUIDs...)
+	}
+	if general && ctx.Err() == nil {
+		folderUIDs, err := searchFolderDashboards(ctx, d.c, 0)
+		if err != nil && ctx.Err() == nil {
+			d.failures.add(err)
+		}
+		uids = append(uids, folderUIDs...)
+	}
+	d.dashboards(ctx, uids, dirs)
+}
+
+// directories returns the directories the folders are saved to, under root
+func (d *downloader) directories(ctx context.Context, root string, folders []client.GrafanaFolder) *folderDirectories {
+	dirs := newFolderDirectories(root, folders)
+	if d.permissions {
+		dirs.onPrepare = func(fol client.GrafanaFolder, dir string) {
+			if err := saveFolderPermissions(ctx, d.c, fol, dir); err != nil && ctx.Err() == nil {
+				d.failures.add(err)
+			}
+		}
+	}
+	return dirs
+}
+
+// folderDirectories prepares the directory of each grafana folder, the first time it is needed.
+// The dashboards in the "General" folder (ID 0) are saved to the root dir, nested folders are
+// saved to the directory of their parent, or to the root dir if their parent is not known.
+type folderDirectories struct {
+	root    string
+	folders map[int64]client.GrafanaFolder
+	ids     map[string]int64
+	dirs    map[int64]string
+	errs    map[int64]error
+	// onPrepare is called once for every folder directory that is prepared, if set
+	onPrepare func(fol client.GrafanaFolder, dir string)
+}
+
+func newFolderDirectories(root string, folders []client.GrafanaFolder) *folderDirectories {
+	d := &folderDirectories{
+		root:    root,
+		folders: map[int64]client.GrafanaFolder{},
+		ids:     map[string]int64{},
+		dirs:    map[int64]string{0: root},
+		errs:    map[int64]error{},
+	}
+	for _, fol := range folders {
+		// the parents of a folder are not saved, the directory it is in is its parent
+		fol.Parents = nil
+		d.folders[fol.ID] = fol
+		d.ids[fol.UID] = fol.ID
+	}
+	return d
+}
+
+// get returns the directory of a folder. A folder which could not be prepared
+// returns the same error every time, it is not prepared again.
+func (d *folderDirectories) get(folderID int64) (string, error) {
+	if dir, ok := d.dirs[folderID]; ok {
+		return dir, nil
+	}
+	if err, ok := d.errs[folderID]; ok {
+		return "", err
+	}
+	fol, found := d.folders[folderID]
+	if !found {
+		return "", fmt.Errorf("Unable to find folder %d", folderID)
+	}
+	parentDir := d.root
+	if parentID, ok := d.ids[fol.ParentUID]; ok {
+		// an error is kept first, so that a cycle of parents ends in an error
+		d.errs[folderID] = fmt.Errorf("Folder '%s' is nested in itself", fol.Title)
+		dir, err := d.get(parentID)
+		if err != nil {
+			d.errs[folderID] = fmt.Errorf("Skipping folder '%s': %w", fol.Title, err)
+			return "", d.errs[folderID]
+		}
+		delete(d.errs, folderID)
+		parentDir = dir
+	}
+	dir, err := prepareFolderDirectory(parentDir, fol)
+	if err != nil {
+		d.errs[folderID] = err
+		return "", err
+	}
+	d.dirs[folderID] = dir
+	if d.onPrepare != nil {
+		d.onPrepare(fol, dir)
+	}
+	return dir, nil
+}
+
+// folderDirectory returns the directory, under the root dir, that a grafana folder is saved to
+func folderDirectory(root string, fol client.GrafanaFolder) string {
+	return filepath.Join(root, sanitizeDirectoryName(fol.Title))
+}
+
+// sanitizeDirectoryName turns the name of a folder or organization into a directory name
+func sanitizeDirectoryName(name string) string {
+	sanitizeRegex, _ := regexp.Compile("[^A-Za-z0-9._-]")
+	dirName := strings.ToLower(name)
+	return string(sanitizeRegex.ReplaceAll([]byte(dirName), []byte("_")))
+}
+
+// prepareFolderDirectory ensures the directory for a grafana folder exists, and that
+// it is signed with a matching .folder.json file.
+// An error is returned if the folder should be skipped.
+func prepareFolderDirectory(root string, fol client.GrafanaFolder) (string, error) {
+	dirName := folderDirectory(root, fol)
+	signatureFile := filepath.Join(dirName, ".folder.json")
+
+	// Check if a folder already exists
+	exists, _ := os.Lstat(dirName)
+	if exists == nil {
+		// Attempt to create the directory
+		if err := os.MkdirAll(dirName, 0744); err != nil {
+			return "", fmt.Errorf("Error creating directory %s: %s", dirName, err)
+		}
+		// Save the folder signature into the directory
+		fileContents, err := json.Marshal(fol)
+		if err != nil {
+			return "", fmt.Errorf("Unable to marshal json: %v\nError: %s", fol, err)
+		}
+		if err = ioutil.WriteFile(signatureFile, fileContents, 0666); err != nil {
+			return "", fmt.Errorf("Error writing %s: %s", signatureFile, err)
+		}
+		return dirName, nil
+	}
+
+	// Read the .folder.json file and unmarshal it
+	directoryIsFolder, err := isDirectoryMatch(fol, dirName)
+	if err != nil {
+		return "", err
+	}
+	if !directoryIsFolder {
+		// TODO: append the UID to the folder name and try again
+		return "", fmt.Errorf("Folder signatures don't match\nThe folder '%s' will be skipped", fol.Title)
+	}
+	fmt.Printf("Existing directory '%s' matches the existing grafana folder '%s'. Overwriting.\n", dirName, fol.Title)
+	return dirName, nil
+}
+
+// searchFolderDashboards returns the UIDs of all of the dashboards in a folder
+func searchFolderDashboards(ctx context.Context, c *client.Client, folderID int64) ([]string, error) {
+	folderIDs := strconv.FormatInt(folderID, 10)
+	query := url.Values{}
+	query.Add("folderIds", folderIDs)
+	results, err := c.SearchAllDashboardsWithContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error searching dashboards in folder %s: %w", folderIDs, err)
+	}
+	uids := make([]string, 0, len(results))
+	for _, board := range results {
+		uids = append(uids, board.UID)
+	}
+	return uids, nil
+}
+
+// dashboards downloads dashboards by UID, with up to parallel requests at once.
+// Each dashboard is saved into the directory of the grafana folder it belongs to,
+// in the order of the UIDs.
+func (d *downloader) dashboards(ctx context.Context, uids []string, dirs *folderDirectories) {
+	d.total += len(uids)
+	// the datasources are listed for every organization
+	if d.portable && len(uids) > 0 {
+		exporter, err := newPortableExporter(ctx, d.c)
+		if err != nil {
+			if ctx.Err() == nil {
+				d.failures.add(err)
+			}
+			return
+		}
+		d.exporter = exporter
+	}
+	runParallel(ctx, d.parallel, len(uids), func(i int) func() {
+		uid := uids[i]
+		dash, err := d.c.GetDashboardWithContext(ctx, uid)
+		return func() {
+			switch {
+			case err != nil && ctx.Err() != nil:
+				// interrupted, this is reported by report()
+				return
+			case err != nil:
+				d.failures.addf("error downloading dashboard %s: %w", uid, err)
+				return
+			}
+			targetDir, err := dirs.get(dash.Meta.FolderId)
+			if err != nil {
+				d.failures.addf("Skipping dashboard %s: %w", uid, err)
+				return
+			}
+			path, err := d.saveDashboard(dash, targetDir)
+			if err != nil {
+				d.failures.addf("%s: %w", uid, err)
+				return
+			}
+			d.downloaded++
+			d.saved = append(d.saved, savedDashboard{
+				path:  path,
+				uid:   uid,
+				title: dash.Dashboard.Get("title").MustString(),
+				meta:  dash.Meta,
+			})
+		}
+	})
+}
+
+// saveDashboard writes a single dashboard to a file in the target dir, and returns its path.
+// The dashboard is normalized, so that files only change when the dashboard does.
+func (d *downloader) saveDashboard(dash client.GrafanaDashboardFullWithMeta, targetDir string) (string, error) {
+	path := filepath.Join(targetDir, fmt.Sprintf("%s.%s", dash.Meta.Slug, d.format))
+	raw, _ := dash.Dashboard.Encode()
+	if d.portable {
+		var (
+			unresolved []dashboard.UnresolvedDataSource
+			err        error
+		)
+		if raw, unresolved, err = d.exporter.export(raw); err != nil {
+			return "", fmt.Errorf("error exporting: %s", err)
+		}
+		for _, u := range unresolved {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %s, it is not an input\n", path, u)
+		}
+	}
+	rawBoard, err := formatDashboardFile(path, raw, d.normalize)
+	if err != nil {
+		return "", fmt.Errorf("error formatting: %s", err)
+	}
+	// Write the dashboard to file
+	if err := ioutil.WriteFile(path, rawBoard, 0666); err != nil {
+		return "", fmt.Errorf("error writing: %s", err)
 	}
-	return nil
+	fmt.Printf("Downloaded %s\n", path)
+	return path, nil
 }
 
 func init() {
 	dashboardCmd.AddCommand(downloadCmd)
 	downloadCmd.Flags().BoolP("all", "a", false, "Download all dashboards")
+	downloadCmd.Flags().Bool("all-orgs", false, "Download all dashboards of every organization, each to its own directory. Requires server admin credentials.")
 	downloadCmd.Flags().StringP("target", "t", ".", "Target directory to save dashboard files.")
+	downloadCmd.Flags().Int("parallel", 1, "Number of dashboards to download at once")
+	downloadCmd.Flags().Bool("permissions", false, "Save the permissions of every folder to a .permissions.json file")
+	downloadCmd.Flags().Bool("git-commit", false, "Commit the downloaded changes to the git repository of the target dir")
+	downloadCmd.Flags().String("git-commit-mode", "per-dashboard", "How changes are committed with --git-commit: per-dashboard or single")
+	downloadCmd.Flags().String("format", formatJSON, "Format of dashboard files: json or yaml")
+	downloadCmd.Flags().Bool("portable", false, "Save dashboards for sharing externally, with their datasources as __inputs")
+	addNormalizeFlags(downloadCmd)
+	// selectors share their names with the search flags, so that getSearchParams can read them
+	downloadCmd.Flags().StringP("query", "q", "", "Download dashboards matching a search query")
+	downloadCmd.Flags().StringSlice("tag", []string{}, "Download dashboards with these tags")
+	downloadCmd.Flags().IntSliceP("folder", "f", []int{}, "Download dashboards in these folder id's")
 	viper.BindPFlags(downloadCmd.Flags())
 }
@@ -19,11 +19,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
 
 	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/platform9/grafanactl/pkg/printer"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // folder command does not do anything, but is needed for scoping of subcommands
@@ -33,8 +38,202 @@ var folderCmd = &cobra.Command{
 	Long:  "Perform operations on Grafana Folders",
 }
 
+var folderCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a folder",
+	Long: `Create a folder
+
+Grafana generates a UID for the folder, unless one is given with --uid.
+Use --parent-uid to create it inside another folder, on grafana versions
+with nested folders.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		title := viper.GetString("title")
+		if title == "" {
+			fmt.Fprintln(os.Stderr, "Error: --title must be specified.")
+			os.Exit(exitError)
+		}
+		requireAuthParams()
+		c := getGrafanaClient()
+		fol, err := c.CreateNestedFolderWithContext(commandContext(), viper.GetString("uid"), title, viper.GetString("parent-uid"))
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to create folder '%s': %w", title, err))
+		}
+		fmt.Printf("Created folder %s (%s) with ID %d.\n", fol.Title, fol.UID, fol.ID)
+	},
+}
+
+var folderRenameCmd = &cobra.Command{
+	Use:   "rename <uid> <title>",
+	Short: "Change the title of a folder",
+	Long: `Change the title of a folder
+
+The folder is not renamed if it is changed by someone else at the same time.
+Use --version to only rename it if it is still at the version you expect, and
+--overwrite to rename it no matter what.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		uid, title := args[0], args[1]
+		requireAuthParams()
+		ctx := commandContext()
+		c := getGrafanaClient()
+		fol, err := c.GetFolderWithContext(ctx, uid)
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to get folder %s: %w", uid, err))
+		}
+		version := fol.Version
+		if cmd.Flags().Changed("version") {
+			version = viper.GetInt("version")
+		}
+		renamed, err := c.UpdateFolderWithContext(ctx, uid, title, version, viper.GetBool("overwrite"))
+		if client.IsVersionMismatch(err) {
+			fmt.Fprintf(os.Stderr, "Error: folder %s (%s) was changed by someone else, it is no longer at version %d.\n", fol.Title, uid, version)
+			fmt.Fprintln(os.Stderr, "Use --overwrite to rename it anyway.")
+			os.Exit(exitConflict)
+		}
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to rename folder %s: %w", uid, err))
+		}
+		fmt.Printf("Renamed folder %s (%s) to '%s', it is now at version %d.\n", fol.Title, uid, renamed.Title, renamed.Version)
+	},
+}
+
+var folderDeleteCmd = &cobra.Command{
+	Use:   "delete <uid>",
+	Short: "Delete a folder",
+	Long: `Delete a folder
+
+Grafana deletes the dashboards in a folder along with it. A folder that holds
+dashboards is only deleted with --recursive.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uid := args[0]
+		requireAuthParams()
+		ctx := commandContext()
+		c := getGrafanaClient()
+		fol, err := c.GetFolderWithContext(ctx, uid)
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to get folder %s: %w", uid, err))
+		}
+		query := url.Values{}
+		query.Add("folderIds", strconv.FormatInt(fol.ID, 10))
+		results, err := c.SearchDashboardsWithContext(ctx, query)
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to check the contents of folder %s: %w", uid, err))
+		}
+		if len(results) > 0 && !viper.GetBool("recursive") {
+			fmt.Fprintf(os.Stderr, "Error: folder %s (%s) holds %d dashboards. Use --recursive to delete them with the folder.\n", fol.Title, uid, len(results))
+			os.Exit(exitError)
+		}
+		if err = c.DeleteFolderWithContext(ctx, uid); err != nil {
+			exitWithError(fmt.Errorf("unable to delete folder %s: %w", uid, err))
+		}
+		for _, hit := range results {
+			fmt.Printf("Deleted dashboard %s (%s)\n", hit.Title, hit.UID)
+		}
+		fmt.Printf("Deleted folder %s (%s)\n", fol.Title, uid)
+	},
+}
+
+var folderGetCmd = &cobra.Command{
+	Use:   "get <uid>",
+	Short: "Show a folder",
+	Long:  `Show a folder`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireAuthParams()
+		c := getGrafanaClient()
+		fol, err := c.GetFolderWithContext(commandContext(), args[0])
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to get folder %s: %w", args[0], err))
+		}
+		printList(folderList{fol})
+	},
+}
+
+var folderDownloadCmd = &cobra.Command{
+	Use:   "download <uid>",
+	Short: "Download a folder and its dashboards",
+	Long: `Download a folder and its dashboards
+
+The folder is saved to a directory named after it, under the target dir.
+Folders nested in it are saved to directories inside of it.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireAuthParams()
+		ctx := commandContext()
+		c := getGrafanaClient()
+		d := newDownloader(c)
+		fol, err := c.GetFolderWithContext(ctx, args[0])
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to get folder %s: %w", args[0], err))
+		}
+		d.folder(ctx, viper.GetString("target"), fol)
+		d.report(ctx)
+	},
+}
+
+// folderList prints folders
+type folderList []client.GrafanaFolder
+
+func (l folderList) Columns() []printer.Column {
+	return []printer.Column{
+		{Header: "Id"},
+		{Header: "UID"},
+		{Header: "Title"},
+		{Header: "Version"},
+		{Header: "Parent UID", Wide: true},
+		{Header: "URL", Wide: true},
+		{Header: "Updated By", Wide: true},
+		{Header: "Updated", Wide: true},
+	}
+}
+
+func (l folderList) Len() int {
+	return len(l)
+}
+
+func (l folderList) Row(i int) []string {
+	fol := l[i]
+	return []string{
+		strconv.FormatInt(fol.ID, 10),
+		fol.UID,
+		fol.Title,
+		strconv.Itoa(fol.Version),
+		fol.ParentUID,
+		fol.URL,
+		fol.UpdatedBy,
+		fol.Updated.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func (l folderList) Name(i int) string {
+	return l[i].UID
+}
+
+func (l folderList) Items() interface{} {
+	return []client.GrafanaFolder(l)
+}
+
 func init() {
 	rootCmd.AddCommand(folderCmd)
+	folderCmd.AddCommand(folderCreateCmd)
+	folderCmd.AddCommand(folderRenameCmd)
+	folderCmd.AddCommand(folderDeleteCmd)
+	folderCmd.AddCommand(folderGetCmd)
+	folderCmd.AddCommand(folderDownloadCmd)
+
+	folderCreateCmd.Flags().String("title", "", "Title of the folder")
+	folderCreateCmd.Flags().String("uid", "", "UID of the folder, generated by grafana if not set")
+	folderCreateCmd.Flags().String("parent-uid", "", "UID of the folder to create the folder in (default: the top level)")
+	folderRenameCmd.Flags().Int("version", 0, "Only rename the folder if it is at this version (default: the current version)")
+	folderRenameCmd.Flags().Bool("overwrite", false, "Rename the folder, even if it was changed by someone else")
+	folderDeleteCmd.Flags().Bool("recursive", false, "Delete the folder, even if it holds dashboards")
+	folderDownloadCmd.Flags().StringP("target", "t", ".", "Target directory to save the folder to.")
+	folderDownloadCmd.Flags().Int("parallel", 1, "Number of dashboards to download at once")
+	folderDownloadCmd.Flags().Bool("permissions", false, "Save the permissions of the folder to a .permissions.json file")
+	folderDownloadCmd.Flags().String("format", formatJSON, "Format of dashboard files: json or yaml")
+	folderDownloadCmd.Flags().Bool("portable", false, "Save dashboards for sharing externally, with their datasources as __inputs")
+	addNormalizeFlags(folderDownloadCmd)
 }
 
 // isDirectoryMatch inspects a target directory to see if it matches the current grafana folder
@@ -56,5 +255,7 @@ func isDirectoryMatch(newFolder client.GrafanaFolder, targetDirectory string) (b
 	if err = json.Unmarshal(folderJSONRaw, &targetFolder); err != nil {
 		return false, fmt.Errorf("Unable to unmarshal the JSON in %s: %w", folderJSONPath, err)
 	}
-	return newFolder == targetFolder, nil
+	// the parents of a folder are not saved, the directory it is in is its parent
+	newFolder.Parents, targetFolder.Parents = nil, nil
+	return reflect.DeepEqual(newFolder, targetFolder), nil
 }
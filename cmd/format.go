@@ -0,0 +1,178 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/platform9/grafanactl/pkg/dashboard"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var fmtCmd = &cobra.Command{
+	Use:   "fmt [path...]",
+	Short: "Normalize dashboard files",
+	Long: `Normalize dashboard files
+
+The dashboard files in the given files and directories are rewritten the way
+'dashboard download' saves them: indented JSON or YAML with sorted keys, without
+the fields listed by --strip. Directories are walked recursively, files which are
+not dashboards are left alone, as are Jsonnet files. The current directory is used if no path is given.
+
+With --check, no file is changed. The files which are not normalized are listed,
+and the command fails if there are any, e.g. to check dashboards in CI.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			args = []string{"."}
+		}
+		check := viper.GetBool("check")
+		opts := normalizeOptions()
+		var failures failureReport
+		unformatted := 0
+		for _, root := range args {
+			err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() && path != root && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				if !info.Mode().IsRegular() || !isDashboardFile(path) {
+					return nil
+				}
+				raw, err := ioutil.ReadFile(path)
+				if err != nil {
+					failures.addf("Unable to read file %s: %s", path, err)
+					return nil
+				}
+				formatted, err := formatDashboardFile(path, raw, opts)
+				if err != nil {
+					failures.addf("Unable to format %s: %s", path, err)
+					return nil
+				}
+				if bytes.Equal(raw, formatted) {
+					return nil
+				}
+				unformatted++
+				if check {
+					fmt.Println(path)
+					return nil
+				}
+				if err = ioutil.WriteFile(path, formatted, info.Mode().Perm()); err != nil {
+					failures.addf("Error writing %s: %s", path, err)
+					return nil
+				}
+				fmt.Printf("Formatted %s\n", path)
+				return nil
+			})
+			if err != nil {
+				failures.addf("Unable to read %s: %s", root, err)
+			}
+		}
+		if failures.len() > 0 {
+			failures.print(os.Stderr)
+			os.Exit(exitError)
+		}
+		if check && unformatted > 0 {
+			fmt.Fprintf(os.Stderr, "%d dashboard files are not normalized, run 'grafanactl dashboard fmt' to fix them.\n", unformatted)
+			os.Exit(exitError)
+		}
+	},
+}
+
+// normalizeOptions returns how dashboard files are normalized, from --strip and --renumber-panels
+func normalizeOptions() dashboard.NormalizeOptions {
+	return dashboard.NormalizeOptions{
+		Strip:          viper.GetStringSlice("strip"),
+		RenumberPanels: viper.GetBool("renumber-panels"),
+	}
+}
+
+// Formats of dashboard files
+const (
+	formatJSON    = "json"
+	formatYAML    = "yaml"
+	formatJsonnet = "jsonnet"
+)
+
+// dashboardFileFormat returns the format of a dashboard file by its extension, or an empty string for other files
+func dashboardFileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return formatJSON
+	case ".yaml", ".yml":
+		return formatYAML
+	case ".jsonnet", ".libsonnet":
+		return formatJsonnet
+	}
+	return ""
+}
+
+// dashboardDocuments returns the documents of a dashboard file as JSON.
+// A JSON file is a single document, YAML and Jsonnet files can hold several.
+// Jsonnet files are evaluated with opts.
+func dashboardDocuments(path string, raw []byte, opts jsonnetOptions) ([][]byte, error) {
+	switch dashboardFileFormat(path) {
+	case formatYAML:
+		return dashboard.YAMLToJSON(raw)
+	case formatJsonnet:
+		return evaluateJsonnet(path, opts)
+	}
+	return [][]byte{raw}, nil
+}
+
+// formatDashboardFile normalizes the contents of a dashboard file, in the format of its extension.
+// Documents of a YAML file which are not dashboards, like the folder of a bundle, are only reformatted.
+func formatDashboardFile(path string, raw []byte, opts dashboard.NormalizeOptions) ([]byte, error) {
+	docs, err := dashboardDocuments(path, raw, jsonnetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	decoded := make([]map[string]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		dash, err := dashboard.Decode(doc)
+		if err != nil {
+			return nil, err
+		}
+		if dash["panels"] != nil {
+			dashboard.Normalize(dash, opts)
+		}
+		decoded = append(decoded, dash)
+	}
+	if dashboardFileFormat(path) == formatYAML {
+		return dashboard.FormatYAML(decoded...)
+	}
+	return dashboard.Format(decoded[0])
+}
+
+// addNormalizeFlags adds the flags of normalizeOptions to a command
+func addNormalizeFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("strip", dashboard.DefaultStrip, "Fields removed from dashboard files, as dot separated paths where * matches any key or list item")
+	cmd.Flags().Bool("renumber-panels", false, "Number the panels of dashboard files from 1, in the order they appear")
+}
+
+func init() {
+	dashboardCmd.AddCommand(fmtCmd)
+	fmtCmd.Flags().Bool("check", false, "List the files which are not normalized and fail if there are any, without changing them")
+	addNormalizeFlags(fmtCmd)
+	viper.BindPFlags(fmtCmd.Flags())
+}
@@ -0,0 +1,295 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Modes of --git-commit-mode
+const (
+	gitCommitPerDashboard = "per-dashboard"
+	gitCommitSingle       = "single"
+)
+
+// downloadCommitter commits the files written by a download to the git repository of the target dir
+type downloadCommitter struct {
+	repo *git.Repository
+	wt   *git.Worktree
+	// root is the directory of the worktree
+	root string
+	// committer signs every commit, and authors the commits of changes without a dashboard
+	committer object.Signature
+}
+
+// commitDownload commits the changed, added and removed files under target.
+// With prune, the tracked dashboard files which were not saved are removed first,
+// their dashboards were deleted in grafana.
+func commitDownload(target string, saved []savedDashboard, mode string, prune bool) error {
+	repo, err := git.PlainOpenWithOptions(target, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return fmt.Errorf("%s is not in a git repository: %w", target, err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	gc := &downloadCommitter{
+		repo:      repo,
+		wt:        wt,
+		root:      wt.Filesystem.Root(),
+		committer: gitCommitter(repo),
+	}
+	// the commits are made from the index, they would include anything staged before
+	staged, err := gc.staged()
+	if err != nil {
+		return err
+	}
+	if len(staged) > 0 {
+		return fmt.Errorf("the git index has staged changes, commit or unstage them first: %s", strings.Join(staged, ", "))
+	}
+	if prune {
+		if err = gc.removeStaleDashboards(target, saved); err != nil {
+			return err
+		}
+	}
+	changes, err := gc.changes(target)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Println("No changes to commit.")
+		return nil
+	}
+
+	if mode == gitCommitPerDashboard {
+		for _, dash := range saved {
+			path := gc.relative(dash.path)
+			status, changed := changes[path]
+			if !changed {
+				continue
+			}
+			delete(changes, path)
+			verb := "Update"
+			if status == git.Untracked {
+				verb = "Add"
+			}
+			author := gc.author(dash.meta.UpdatedBy, dash.meta.Updated)
+			if err = gc.commit([]string{path}, fmt.Sprintf("%s dashboard %s (%s)", verb, dash.title, dash.uid), author); err != nil {
+				return err
+			}
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+	}
+
+	// commit the rest at once, authored by the user who updated the dashboards if they all agree
+	paths := make([]string, 0, len(changes))
+	for path := range changes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	updatedBy := ""
+	for _, dash := range saved {
+		if _, changed := changes[gc.relative(dash.path)]; !changed {
+			continue
+		}
+		if updatedBy != "" && updatedBy != dash.meta.UpdatedBy {
+			updatedBy = ""
+			break
+		}
+		updatedBy = dash.meta.UpdatedBy
+	}
+	lines := make([]string, 0, len(paths))
+	for _, path := range paths {
+		verb := "Update"
+		switch changes[path] {
+		case git.Untracked:
+			verb = "Add"
+		case git.Deleted:
+			verb = "Remove"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s", verb, path))
+	}
+	message := fmt.Sprintf("Download dashboards from grafana\n\n%s\n", strings.Join(lines, "\n"))
+	return gc.commit(paths, message, gc.author(updatedBy, time.Now()))
+}
+
+// changes returns the status of the changed files under target, by their path in the worktree
+func (gc *downloadCommitter) changes(target string) (map[string]git.StatusCode, error) {
+	status, err := gc.wt.Status()
+	if err != nil {
+		return nil, err
+	}
+	prefix := gc.relative(target)
+	changes := map[string]git.StatusCode{}
+	for path, s := range status {
+		if prefix != "." && path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		if s.Worktree != git.Unmodified {
+			changes[path] = s.Worktree
+		}
+	}
+	return changes, nil
+}
+
+// staged returns the paths of the files with changes in the index
+func (gc *downloadCommitter) staged() ([]string, error) {
+	status, err := gc.wt.Status()
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for path, s := range status {
+		if s.Staging != git.Unmodified && s.Staging != git.Untracked {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// removeStaleDashboards removes the tracked dashboard files under target which were not saved
+func (gc *downloadCommitter) removeStaleDashboards(target string, saved []savedDashboard) error {
+	written := map[string]bool{}
+	for _, dash := range saved {
+		written[gc.relative(dash.path)] = true
+	}
+	idx, err := gc.repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+	prefix := gc.relative(target)
+	for _, entry := range idx.Entries {
+		path := entry.Name
+		if prefix != "." && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		if written[path] || !isDashboardFile(filepath.Join(gc.root, path)) {
+			continue
+		}
+		if err = os.Remove(filepath.Join(gc.root, path)); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s (deleted in grafana)\n", path)
+	}
+	return nil
+}
+
+// commit stages paths and commits them
+func (gc *downloadCommitter) commit(paths []string, message string, author object.Signature) error {
+	for _, path := range paths {
+		if _, err := gc.wt.Add(path); err != nil {
+			return fmt.Errorf("unable to stage %s: %w", path, err)
+		}
+	}
+	committer := gc.committer
+	committer.When = time.Now()
+	hash, err := gc.wt.Commit(message, &git.CommitOptions{
+		Author:    &author,
+		Committer: &committer,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Committed %s %s\n", hash.String()[:7], strings.SplitN(message, "\n", 2)[0])
+	return nil
+}
+
+// author returns the signature of a grafana user, or the committer if there is none
+func (gc *downloadCommitter) author(login string, when time.Time) object.Signature {
+	author := gc.committer
+	if login != "" {
+		// grafana only knows the login of the user, which is the email for some
+		author = object.Signature{Name: login}
+		if strings.Contains(login, "@") {
+			author.Email = login
+		}
+	}
+	author.When = when
+	if when.IsZero() {
+		author.When = time.Now()
+	}
+	return author
+}
+
+// relative returns the slash separated path of a file in the worktree
+func (gc *downloadCommitter) relative(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(gc.root, abs)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// gitCommitter returns the user of the git config, or grafanactl if none is configured
+func gitCommitter(repo *git.Repository) object.Signature {
+	committer := object.Signature{Name: "grafanactl", Email: "grafanactl@localhost"}
+	cfg, err := repo.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return committer
+	}
+	if cfg.User.Name != "" {
+		committer.Name = cfg.User.Name
+	}
+	if cfg.User.Email != "" {
+		committer.Email = cfg.User.Email
+	}
+	return committer
+}
+
+// isDashboardFile checks if a JSON or YAML file holds dashboards, like readDashboardFile
+// but without reporting skipped files. Jsonnet files are sources of dashboards, not dashboard files.
+func isDashboardFile(path string) bool {
+	if base := filepath.Base(path); base == ".folder.json" || base == permissionsFile {
+		return false
+	}
+	if format := dashboardFileFormat(path); format != formatJSON && format != formatYAML {
+		return false
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	docs, err := dashboardDocuments(path, raw, jsonnetOptions{})
+	if err != nil {
+		return false
+	}
+	for _, doc := range docs {
+		var contents map[string]interface{}
+		if err = json.Unmarshal(doc, &contents); err == nil && contents["panels"] != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/platform9/grafanactl/pkg/client"
+)
+
+// gitTree is a git repository in a temporary directory, with an initial commit of files
+type gitTree struct {
+	t    *testing.T
+	root string
+	repo *git.Repository
+	wt   *git.Worktree
+}
+
+// newGitTree creates the repository, the caller removes it with os.RemoveAll(tree.root)
+func newGitTree(t *testing.T, files map[string]string) *gitTree {
+	t.Helper()
+	root, err := ioutil.TempDir("", "grafanactl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := git.PlainInit(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := &gitTree{t: t, root: root, repo: repo, wt: wt}
+	tree.write(files)
+	for path := range files {
+		if _, err = wt.Add(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = wt.Commit("Initial commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@localhost", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func (tree *gitTree) write(files map[string]string) {
+	tree.t.Helper()
+	for path, contents := range files {
+		path = filepath.Join(tree.root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			tree.t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			tree.t.Fatal(err)
+		}
+	}
+}
+
+// commits returns the commits after the initial one, oldest first
+func (tree *gitTree) commits() []*object.Commit {
+	tree.t.Helper()
+	log, err := tree.repo.Log(&git.LogOptions{})
+	if err != nil {
+		tree.t.Fatal(err)
+	}
+	var commits []*object.Commit
+	log.ForEach(func(c *object.Commit) error {
+		if c.NumParents() > 0 {
+			commits = append([]*object.Commit{c}, commits...)
+		}
+		return nil
+	})
+	return commits
+}
+
+// headFiles returns the paths of the files committed in HEAD
+func (tree *gitTree) headFiles() []string {
+	tree.t.Helper()
+	head, err := tree.repo.Head()
+	if err != nil {
+		tree.t.Fatal(err)
+	}
+	commit, err := tree.repo.CommitObject(head.Hash())
+	if err != nil {
+		tree.t.Fatal(err)
+	}
+	files, err := commit.Files()
+	if err != nil {
+		tree.t.Fatal(err)
+	}
+	var paths []string
+	files.ForEach(func(f *object.File) error {
+		paths = append(paths, f.Name)
+		return nil
+	})
+	return paths
+}
+
+func (tree *gitTree) saved(path, uid, title, updatedBy string, updated time.Time) savedDashboard {
+	return savedDashboard{
+		path:  filepath.Join(tree.root, path),
+		uid:   uid,
+		title: title,
+		meta:  client.GrafanaDashboardMeta{UpdatedBy: updatedBy, Updated: updated},
+	}
+}
+
+var (
+	aliceTime = time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	bobTime   = time.Date(2020, 4, 2, 11, 30, 0, 0, time.UTC)
+)
+
+func TestCommitDownloadPerDashboard(t *testing.T) {
+	tree := newGitTree(t, map[string]string{
+		"dashboards/a.json": `{"uid": "a", "title": "A", "panels": []}`,
+	})
+	defer os.RemoveAll(tree.root)
+	tree.write(map[string]string{
+		"dashboards/a.json": `{"uid": "a", "title": "A2", "panels": []}`,
+		"dashboards/b.json": `{"uid": "b", "title": "B", "panels": []}`,
+	})
+	saved := []savedDashboard{
+		tree.saved("dashboards/a.json", "a", "A2", "alice@example.com", aliceTime),
+		tree.saved("dashboards/b.json", "b", "B", "bob", bobTime),
+	}
+	if err := commitDownload(filepath.Join(tree.root, "dashboards"), saved, gitCommitPerDashboard, false); err != nil {
+		t.Fatal(err)
+	}
+
+	commits := tree.commits()
+	if len(commits) != 2 {
+		t.Fatalf("got %d commits, want 2", len(commits))
+	}
+	want := []struct {
+		message, name, email string
+		when                 time.Time
+	}{
+		{message: "Update dashboard A2 (a)", name: "alice@example.com", email: "alice@example.com", when: aliceTime},
+		{message: "Add dashboard B (b)", name: "bob", when: bobTime},
+	}
+	for i, c := range commits {
+		if c.Message != want[i].message {
+			t.Errorf("commit %d: got message %q, want %q", i, c.Message, want[i].message)
+		}
+		if c.Author.Name != want[i].name || c.Author.Email != want[i].email {
+			t.Errorf("commit %d: got author %s <%s>, want %s <%s>", i, c.Author.Name, c.Author.Email, want[i].name, want[i].email)
+		}
+		if !c.Author.When.Equal(want[i].when) {
+			t.Errorf("commit %d: got author time %s, want %s", i, c.Author.When, want[i].when)
+		}
+		if c.Committer.Name == want[i].name {
+			t.Errorf("commit %d: the grafana user is the committer, want the git user", i)
+		}
+	}
+}
+
+func TestCommitDownloadSingle(t *testing.T) {
+	tests := []struct {
+		name       string
+		updatedBy  []string
+		wantAuthor string
+	}{
+		{name: "same user", updatedBy: []string{"alice", "alice"}, wantAuthor: "alice"},
+		{name: "different users", updatedBy: []string{"alice", "bob"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newGitTree(t, map[string]string{
+				"a.json": `{"uid": "a", "title": "A", "panels": []}`,
+			})
+			defer os.RemoveAll(tree.root)
+			tree.write(map[string]string{
+				"a.json": `{"uid": "a", "title": "A2", "panels": []}`,
+				"b.json": `{"uid": "b", "title": "B", "panels": []}`,
+			})
+			saved := []savedDashboard{
+				tree.saved("a.json", "a", "A2", tt.updatedBy[0], aliceTime),
+				tree.saved("b.json", "b", "B", tt.updatedBy[1], bobTime),
+			}
+			if err := commitDownload(tree.root, saved, gitCommitSingle, false); err != nil {
+				t.Fatal(err)
+			}
+
+			commits := tree.commits()
+			if len(commits) != 1 {
+				t.Fatalf("got %d commits, want 1", len(commits))
+			}
+			want := "Download dashboards from grafana\n\nUpdate a.json\nAdd b.json\n"
+			if commits[0].Message != want {
+				t.Errorf("got message %q, want %q", commits[0].Message, want)
+			}
+			author := commits[0].Author.Name
+			if tt.wantAuthor == "" {
+				// without a single grafana user, the git user authors the commit
+				if author != commits[0].Committer.Name {
+					t.Errorf("got author %s, want the committer %s", author, commits[0].Committer.Name)
+				}
+			} else if author != tt.wantAuthor {
+				t.Errorf("got author %s, want %s", author, tt.wantAuthor)
+			}
+		})
+	}
+}
+
+func TestCommitDownloadRemovesStaleDashboards(t *testing.T) {
+	tree := newGitTree(t, map[string]string{
+		"dashboards/a.json":              `{"uid": "a", "title": "A", "panels": []}`,
+		"dashboards/deleted.json":        `{"uid": "deleted", "title": "Deleted", "panels": []}`,
+		"dashboards/f/.folder.json":      `{"uid": "f", "title": "F"}`,
+		"dashboards/f/deleted-too.yaml":  "uid: deleted-too\ntitle: Deleted too\npanels: []\n",
+		"dashboards/f/.permissions.json": `[]`,
+		"dashboards/notes.json":          `{"notes": "not a dashboard"}`,
+		"other/outside.json":             `{"uid": "outside", "title": "Outside", "panels": []}`,
+	})
+	defer os.RemoveAll(tree.root)
+	saved := []savedDashboard{tree.saved("dashboards/a.json", "a", "A", "alice", aliceTime)}
+	if err := commitDownload(filepath.Join(tree.root, "dashboards"), saved, gitCommitPerDashboard, true); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"dashboards/deleted.json", "dashboards/f/deleted-too.yaml"} {
+		if _, err := os.Stat(filepath.Join(tree.root, path)); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", path)
+		}
+	}
+	commits := tree.commits()
+	if len(commits) != 1 {
+		t.Fatalf("got %d commits, want 1", len(commits))
+	}
+	if want := "Remove dashboards/deleted.json\nRemove dashboards/f/deleted-too.yaml\n"; !strings.HasSuffix(commits[0].Message, want) {
+		t.Errorf("got message %q, want it to list %q", commits[0].Message, want)
+	}
+	got := strings.Join(tree.headFiles(), ",")
+	want := "dashboards/a.json,dashboards/f/.folder.json,dashboards/f/.permissions.json,dashboards/notes.json,other/outside.json"
+	if got != want {
+		t.Errorf("got files %s, want %s", got, want)
+	}
+}
+
+func TestCommitDownloadRefusesStagedChanges(t *testing.T) {
+	tree := newGitTree(t, map[string]string{
+		"a.json":    `{"uid": "a", "title": "A", "panels": []}`,
+		"README.md": "dashboards",
+	})
+	defer os.RemoveAll(tree.root)
+	tree.write(map[string]string{
+		"a.json":    `{"uid": "a", "title": "A2", "panels": []}`,
+		"README.md": "work in progress",
+	})
+	if _, err := tree.wt.Add("README.md"); err != nil {
+		t.Fatal(err)
+	}
+	saved := []savedDashboard{tree.saved("a.json", "a", "A2", "alice", aliceTime)}
+	err := commitDownload(tree.root, saved, gitCommitPerDashboard, false)
+	if err == nil || !strings.Contains(err.Error(), "README.md") {
+		t.Fatalf("got error %v, want the staged README.md to be refused", err)
+	}
+	if commits := tree.commits(); len(commits) != 0 {
+		t.Errorf("got %d commits, want none", len(commits))
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/platform9/grafanactl/pkg/dashboard"
+	"github.com/platform9/grafanactl/pkg/printer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history <uid>",
+	Short: "Show the version history of a dashboard",
+	Long: `Show the version history of a dashboard
+
+Every save of a dashboard is kept by grafana as a version. Without --version,
+the versions are listed with their author, date and message.
+
+With --version, the dashboard at that version is printed. Add --diff to compare
+it with the current version instead.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uid := args[0]
+		format := viper.GetString("format")
+		if format != "structural" && format != "unified" {
+			fmt.Fprintf(os.Stderr, "Error: unknown format '%s', must be structural or unified.\n", format)
+			os.Exit(exitError)
+		}
+		requireAuthParams()
+		ctx := commandContext()
+		c := getGrafanaClient()
+		dash, id := getDashboardWithID(ctx, c, uid)
+
+		if !cmd.Flags().Changed("version") {
+			versions, err := c.GetDashboardVersionsWithContext(ctx, id, viper.GetInt("limit"))
+			if err != nil {
+				exitWithError(fmt.Errorf("unable to get the versions of dashboard %s: %w", uid, err))
+			}
+			printList(versionList(versions))
+			return
+		}
+
+		version := viper.GetInt("version")
+		v, err := c.GetDashboardVersionWithContext(ctx, id, version)
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to get version %d of dashboard %s: %w", version, uid, err))
+		}
+		if !viper.GetBool("diff") {
+			raw, _ := json.MarshalIndent(v.Data, "", "  ")
+			fmt.Println(string(raw))
+			return
+		}
+
+		var current map[string]interface{}
+		raw, _ := dash.Dashboard.MarshalJSON()
+		if err = json.Unmarshal(raw, &current); err != nil {
+			exitWithError(err)
+		}
+		title := dash.Dashboard.Get("title").MustString()
+		from := dashboardSet{
+			name: fmt.Sprintf("version %d", version),
+			dashboards: map[string]diffEntry{uid: {
+				location: fmt.Sprintf("version %d", version),
+				title:    title,
+				contents: v.Data,
+			}},
+		}
+		to := dashboardSet{
+			name: "current version",
+			dashboards: map[string]diffEntry{uid: {
+				location: fmt.Sprintf("version %d (current)", dash.Meta.Version),
+				title:    title,
+				contents: current,
+			}},
+		}
+		if printDashboardDiff(from, to, format, dashboard.NormalizeOptions{}) == 0 {
+			fmt.Println("No differences found.")
+		}
+	},
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback <uid>",
+	Short: "Restore a previous version of a dashboard",
+	Long: `Restore a previous version of a dashboard
+
+The version given with --to is saved as the newest version of the dashboard.
+The versions in between are kept, so a rollback can be undone with another one.
+Use 'dashboard history <uid>' to find the version to restore.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uid := args[0]
+		if !cmd.Flags().Changed("to") {
+			fmt.Fprintln(os.Stderr, "Error: --to must be specified.")
+			os.Exit(exitError)
+		}
+		version := viper.GetInt("to")
+		requireAuthParams()
+		ctx := commandContext()
+		c := getGrafanaClient()
+		dash, id := getDashboardWithID(ctx, c, uid)
+		title := dash.Dashboard.Get("title").MustString()
+		if dash.Meta.Version == version {
+			fmt.Printf("Dashboard %s (%s) is already at version %d.\n", title, uid, version)
+			return
+		}
+		saved, err := c.RestoreDashboardVersionWithContext(ctx, id, version)
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to restore version %d of dashboard %s: %w", version, uid, err))
+		}
+		fmt.Printf("Restored dashboard %s (%s) to version %d, saved as version %d.\n", title, uid, version, saved)
+	},
+}
+
+// getDashboardWithID gets a dashboard by UID, and its ID, which the version API uses.
+// Exits if the dashboard can't be found.
+func getDashboardWithID(ctx context.Context, c *client.Client, uid string) (client.GrafanaDashboardFullWithMeta, int64) {
+	dash, err := c.GetDashboardWithContext(ctx, uid)
+	if err != nil {
+		exitWithError(fmt.Errorf("unable to get dashboard %s: %w", uid, err))
+	}
+	return dash, dash.Dashboard.Get("id").MustInt64()
+}
+
+// versionList prints the versions of a dashboard
+type versionList []client.GrafanaDashboardVersion
+
+func (l versionList) Columns() []printer.Column {
+	return []printer.Column{
+		{Header: "Version"},
+		{Header: "Created"},
+		{Header: "Created By"},
+		{Header: "Message"},
+		{Header: "Restored From", Wide: true},
+	}
+}
+
+func (l versionList) Len() int {
+	return len(l)
+}
+
+func (l versionList) Row(i int) []string {
+	v := l[i]
+	restoredFrom := ""
+	if v.RestoredFrom > 0 {
+		restoredFrom = strconv.Itoa(v.RestoredFrom)
+	}
+	return []string{
+		strconv.Itoa(v.Version),
+		v.Created.Format("2006-01-02 15:04:05"),
+		v.CreatedBy,
+		v.Message,
+		restoredFrom,
+	}
+}
+
+func (l versionList) Name(i int) string {
+	return strconv.Itoa(l[i].Version)
+}
+
+func (l versionList) Items() interface{} {
+	return []client.GrafanaDashboardVersion(l)
+}
+
+func init() {
+	dashboardCmd.AddCommand(historyCmd)
+	dashboardCmd.AddCommand(rollbackCmd)
+	historyCmd.Flags().Int("version", 0, "Print the dashboard at this version")
+	historyCmd.Flags().Bool("diff", false, "Compare --version with the current version of the dashboard")
+	historyCmd.Flags().String("format", "structural", "How differences are printed: structural or unified")
+	historyCmd.Flags().Int("limit", 0, "Maximum number of versions to list (default: grafana's limit)")
+	rollbackCmd.Flags().Int("to", 0, "Version to restore")
+}
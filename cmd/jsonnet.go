@@ -0,0 +1,123 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// jsonnetOptions are the settings Jsonnet files are evaluated with
+type jsonnetOptions struct {
+	// jpath are the library search directories
+	jpath []string
+	// extVars are the external variables, by name
+	extVars map[string]string
+}
+
+// jsonnetOptionsFromFlags reads the flags added by addJsonnetFlags
+func jsonnetOptionsFromFlags(cmd *cobra.Command) (jsonnetOptions, error) {
+	opts := jsonnetOptions{
+		jpath:   viper.GetStringSlice("jpath"),
+		extVars: map[string]string{},
+	}
+	extStrs, _ := cmd.Flags().GetStringArray("ext-str")
+	for _, extStr := range extStrs {
+		key, value, err := parseExtStr(extStr)
+		if err != nil {
+			return opts, err
+		}
+		opts.extVars[key] = value
+	}
+	return opts, nil
+}
+
+// evaluateJsonnet renders a Jsonnet file, and returns the dashboards it evaluates to as JSON.
+// A file can evaluate to a dashboard, a list of dashboards, or an object of dashboards
+// by name, like the grafanaDashboards of a monitoring mixin.
+func evaluateJsonnet(path string, opts jsonnetOptions) ([][]byte, error) {
+	vm := jsonnet.MakeVM()
+	vm.Importer(&jsonnet.FileImporter{JPaths: opts.jpath})
+	for key, value := range opts.extVars {
+		vm.ExtVar(key, value)
+	}
+	// evaluated as a file, so that imports are resolved relative to it
+	out, err := vm.EvaluateFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []json.RawMessage
+	if err = json.Unmarshal([]byte(out), &list); err == nil {
+		docs := make([][]byte, 0, len(list))
+		for _, item := range list {
+			docs = append(docs, item)
+		}
+		return docs, nil
+	}
+	var byName map[string]json.RawMessage
+	if err = json.Unmarshal([]byte(out), &byName); err != nil {
+		return nil, fmt.Errorf("%s must evaluate to a dashboard, or a list or object of dashboards", path)
+	}
+	if _, ok := byName["panels"]; ok {
+		return [][]byte{[]byte(out)}, nil
+	}
+	names := make([]string, 0, len(byName))
+	for name, item := range byName {
+		var dash map[string]interface{}
+		if json.Unmarshal(item, &dash) != nil || dash["panels"] == nil {
+			// not an object of dashboards, it is reported as a file that is not a dashboard
+			return [][]byte{[]byte(out)}, nil
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	docs := make([][]byte, 0, len(names))
+	for _, name := range names {
+		docs = append(docs, byName[name])
+	}
+	return docs, nil
+}
+
+// parseExtStr parses an --ext-str flag. Like the jsonnet command, a name without
+// a value takes the value of the environment variable of that name.
+func parseExtStr(extStr string) (string, string, error) {
+	parts := strings.SplitN(extStr, "=", 2)
+	if parts[0] == "" {
+		return "", "", fmt.Errorf("invalid --ext-str '%s', must be name=value or name", extStr)
+	}
+	if len(parts) == 2 {
+		return parts[0], parts[1], nil
+	}
+	value, ok := os.LookupEnv(parts[0])
+	if !ok {
+		return "", "", fmt.Errorf("--ext-str %s: environment variable %s is not set", parts[0], parts[0])
+	}
+	return parts[0], value, nil
+}
+
+// addJsonnetFlags adds the flags of jsonnetOptions to a command
+func addJsonnetFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceP("jpath", "J", []string{}, "Library search directories of Jsonnet files")
+	cmd.Flags().StringArray("ext-str", []string{}, "External variable of Jsonnet files, as name=value, or name to read it from the environment")
+}
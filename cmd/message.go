@@ -0,0 +1,94 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"text/template"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/spf13/viper"
+)
+
+// defaultMessageTemplate is the change note of the dashboard versions saved by upload and sync
+const defaultMessageTemplate = "synced by grafanactl from {{if .GitSHA}}{{.GitSHA}}/{{end}}{{.Hostname}}"
+
+// messageData holds the fields available to --message-template
+type messageData struct {
+	// Command is upload or sync
+	Command string
+	// Source is the uploaded file or directory, or the context dashboards are synced from
+	Source string
+	// GitSHA is the short commit hash of the git repository of the uploaded files,
+	// or of --source-dir for sync, if any
+	GitSHA   string
+	Hostname string
+	User     string
+}
+
+// saveMessage returns the change note of the dashboard versions saved by a command.
+// This is --message if set, otherwise --message-template is executed.
+// dir is the directory of the git repository the dashboards come from, or empty if they
+// don't come from one, then the change note has no commit.
+func saveMessage(command, source, dir string) (string, error) {
+	if message := viper.GetString("message"); message != "" {
+		return message, nil
+	}
+	tmpl, err := template.New("message").Parse(viper.GetString("message-template"))
+	if err != nil {
+		return "", fmt.Errorf("invalid --message-template: %w", err)
+	}
+	data := messageData{
+		Command: command,
+		Source:  source,
+		GitSHA:  gitCommit(dir),
+	}
+	data.Hostname, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		data.User = u.Username
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("invalid --message-template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// gitCommit returns the short hash of the commit checked out in the git repository
+// of a file or directory, or an empty string if it is not in one, or no path is given
+func gitCommit(path string) string {
+	// an empty path would be the current directory, which may be any repository
+	if path == "" {
+		return ""
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		path = filepath.Dir(path)
+	}
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return ""
+	}
+	// a repository without commits has no HEAD yet
+	head, err := repo.Head()
+	if err != nil {
+		return ""
+	}
+	return head.Hash().String()[:7]
+}
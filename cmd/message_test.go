@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestGitCommit(t *testing.T) {
+	tree := newGitTree(t, map[string]string{
+		"dashboards/a.json": `{"uid": "a", "title": "A", "panels": []}`,
+	})
+	defer os.RemoveAll(tree.root)
+	head, err := tree.repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha := head.Hash().String()[:7]
+	empty, err := ioutil.TempDir("", "grafanactl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(empty)
+	if _, err = git.PlainInit(empty, false); err != nil {
+		t.Fatal(err)
+	}
+	outside, err := ioutil.TempDir("", "grafanactl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+
+	tests := []struct {
+		name, path, want string
+	}{
+		{name: "root", path: tree.root, want: sha},
+		{name: "directory", path: filepath.Join(tree.root, "dashboards"), want: sha},
+		{name: "file", path: filepath.Join(tree.root, "dashboards", "a.json"), want: sha},
+		{name: "not a repository", path: outside},
+		{name: "no commits", path: empty},
+		// the tests run in the repository of grafanactl, it must not be used
+		{name: "no path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gitCommit(tt.path); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
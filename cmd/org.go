@@ -0,0 +1,214 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/platform9/grafanactl/pkg/printer"
+	"github.com/spf13/cobra"
+)
+
+// org command does not do anything, but is needed for scoping of subcommands
+var orgCmd = &cobra.Command{
+	Use:   "org",
+	Short: "Perform operations on Grafana Organizations",
+	Long: `Perform operations on Grafana Organizations
+
+Every other command acts on a single organization. By default this is the
+organization of the API key, or the current organization of the user. Use
+the global --org-id or --org-name flags, or the org-id or org-name settings of a
+context, to act on another organization. This requires basic authentication
+with a user that is a member of the organization, or a server admin.`,
+}
+
+var orgListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the organizations",
+	Long: `List the organizations
+
+Server admins see every organization, other users see the organizations they
+are a member of.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		requireAuthParams()
+		ctx := commandContext()
+		c := getGrafanaClient()
+		orgs, err := listOrgs(ctx, c)
+		if err != nil {
+			exitWithError(err)
+		}
+		current, err := c.GetCurrentOrgWithContext(ctx)
+		if err != nil {
+			exitWithError(err)
+		}
+		printList(orgList{orgs: orgs, current: current.ID})
+	},
+}
+
+var orgCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create an organization",
+	Long:  `Create an organization`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireAuthParams()
+		c := getGrafanaClient()
+		id, err := c.CreateOrgWithContext(commandContext(), args[0])
+		if err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("Created organization '%s' with ID %d.\n", args[0], id)
+	},
+}
+
+var orgSwitchCmd = &cobra.Command{
+	Use:   "switch <id|name>",
+	Short: "Set the organization of the current context in the config file",
+	Long: `Set the organization of the current context in the config file
+
+The organization is looked up in grafana, and its ID is saved as the org-id of
+the current context. Without contexts, the top level org-id is saved.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireAuthParams()
+		ctx := commandContext()
+		c := getGrafanaClient()
+		orgs, err := listOrgs(ctx, c)
+		if err != nil {
+			exitWithError(err)
+		}
+		org, found := matchOrg(orgs, args[0])
+		if !found {
+			fmt.Fprintf(os.Stderr, "Error: organization '%s' was not found.\n", args[0])
+			os.Exit(exitNotFound)
+		}
+
+		name := currentContextName()
+		err = updateConfigFile(func(config map[interface{}]interface{}) {
+			settings := config
+			if name != "" {
+				contexts, ok := config["contexts"].(map[interface{}]interface{})
+				if !ok {
+					contexts = map[interface{}]interface{}{}
+					config["contexts"] = contexts
+				}
+				if settings, ok = contexts[name].(map[interface{}]interface{}); !ok {
+					settings = map[interface{}]interface{}{}
+					contexts[name] = settings
+				}
+			}
+			settings["org-id"] = org.ID
+			delete(settings, "org-name")
+		})
+		if err != nil {
+			exitWithError(err)
+		}
+		if name != "" {
+			fmt.Printf("Switched context '%s' to organization '%s' (%d).\n", name, org.Name, org.ID)
+			return
+		}
+		fmt.Printf("Switched to organization '%s' (%d).\n", org.Name, org.ID)
+	},
+}
+
+// listOrgs lists every organization for server admins, and the
+// organizations the user is a member of for everyone else
+func listOrgs(ctx context.Context, c *client.Client) ([]client.GrafanaOrg, error) {
+	orgs, err := c.GetAllOrgsWithContext(ctx)
+	if client.IsForbidden(err) || client.IsUnauthorized(err) {
+		return c.GetUserOrgsWithContext(ctx)
+	}
+	return orgs, err
+}
+
+// matchOrg finds an organization by ID or name
+func matchOrg(orgs []client.GrafanaOrg, idOrName string) (client.GrafanaOrg, bool) {
+	for _, org := range orgs {
+		if org.Name == idOrName || strconv.FormatInt(org.ID, 10) == idOrName {
+			return org, true
+		}
+	}
+	return client.GrafanaOrg{}, false
+}
+
+// findOrg looks up an organization by name, for server admins and members of the organization
+func findOrg(ctx context.Context, c *client.Client, name string) (client.GrafanaOrg, error) {
+	org, err := c.GetOrgByNameWithContext(ctx, name)
+	switch {
+	case err == nil:
+		return org, nil
+	case !client.IsForbidden(err) && !client.IsUnauthorized(err):
+		return org, fmt.Errorf("unable to find organization '%s': %w", name, err)
+	}
+	// only server admins can look up organizations by name
+	orgs, err := c.GetUserOrgsWithContext(ctx)
+	if err != nil {
+		return org, fmt.Errorf("unable to find organization '%s': %w", name, err)
+	}
+	for _, org := range orgs {
+		if org.Name == name {
+			return org, nil
+		}
+	}
+	return org, fmt.Errorf("organization '%s' was not found, or you are not a member of it", name)
+}
+
+// orgList prints organizations, marking the one that requests act on
+type orgList struct {
+	orgs    []client.GrafanaOrg
+	current int64
+}
+
+func (l orgList) Columns() []printer.Column {
+	return []printer.Column{
+		{Header: "Current"},
+		{Header: "Id"},
+		{Header: "Name"},
+		{Header: "Role", Wide: true},
+	}
+}
+
+func (l orgList) Len() int {
+	return len(l.orgs)
+}
+
+func (l orgList) Row(i int) []string {
+	org := l.orgs[i]
+	marker := ""
+	if org.ID == l.current {
+		marker = "*"
+	}
+	return []string{marker, strconv.FormatInt(org.ID, 10), org.Name, org.Role}
+}
+
+func (l orgList) Name(i int) string {
+	return l.orgs[i].Name
+}
+
+func (l orgList) Items() interface{} {
+	return l.orgs
+}
+
+func init() {
+	rootCmd.AddCommand(orgCmd)
+	orgCmd.AddCommand(orgListCmd)
+	orgCmd.AddCommand(orgCreateCmd)
+	orgCmd.AddCommand(orgSwitchCmd)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// getParallel reads the number of concurrent requests from the --parallel flag
+func getParallel() int {
+	parallel := viper.GetInt("parallel")
+	if parallel < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --parallel must be at least 1, got %d.\n", parallel)
+		os.Exit(exitError)
+	}
+	return parallel
+}
+
+// runParallel calls work for every index from 0 to n-1, on up to parallel goroutines.
+// The function returned by work is called on the calling goroutine, in the order
+// of the indexes, so that output stays the same no matter which request finishes
+// first. It may be nil. No more work is started once ctx is cancelled.
+func runParallel(ctx context.Context, parallel, n int, work func(i int) func()) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	// every index gets exactly one result, buffered so that workers never block
+	results := make([]chan func(), n)
+	for i := range results {
+		results[i] = make(chan func(), 1)
+	}
+	indexes := make(chan int)
+	for w := 0; w < parallel && w < n; w++ {
+		go func() {
+			for i := range indexes {
+				results[i] <- work(i)
+			}
+		}()
+	}
+	go func() {
+		defer close(indexes)
+		for i := 0; i < n; i++ {
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				// the work that was not started has nothing to report
+				for ; i < n; i++ {
+					results[i] <- nil
+				}
+				return
+			}
+		}
+	}()
+	for i := 0; i < n; i++ {
+		if report := <-results[i]; report != nil {
+			report()
+		}
+	}
+}
+
+// failureReport collects the errors of a bulk command, to be printed once it is done
+type failureReport struct {
+	errs []error
+}
+
+func (r *failureReport) add(err error) {
+	r.errs = append(r.errs, err)
+}
+
+func (r *failureReport) addf(format string, a ...interface{}) {
+	r.add(fmt.Errorf(format, a...))
+}
+
+func (r *failureReport) len() int {
+	return len(r.errs)
+}
+
+// exitCode returns the exit code matching the kind of the errors, if they are all of the same kind
+func (r *failureReport) exitCode() int {
+	code := exitError
+	for i, err := range r.errs {
+		if i == 0 {
+			code = exitCode(err)
+		} else if exitCode(err) != code {
+			return exitError
+		}
+	}
+	return code
+}
+
+// print writes every error, in the order they were added
+func (r *failureReport) print(w io.Writer) {
+	if len(r.errs) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Errors:")
+	for _, err := range r.errs {
+		fmt.Fprintf(w, "  %s\n", err)
+	}
+}
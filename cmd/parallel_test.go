@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/platform9/grafanactl/pkg/client"
+)
+
+func TestFailureReportExitCode(t *testing.T) {
+	notFound := &client.APIError{StatusCode: http.StatusNotFound}
+	unauthorized := &client.APIError{StatusCode: http.StatusUnauthorized}
+	forbidden := &client.APIError{StatusCode: http.StatusForbidden}
+	conflict := &client.APIError{StatusCode: http.StatusPreconditionFailed, Status: "version-mismatch"}
+	tests := []struct {
+		name string
+		errs []error
+		want int
+	}{
+		{name: "no errors", want: exitError},
+		{name: "not found", errs: []error{notFound, fmt.Errorf("error downloading dashboard a: %w", notFound)}, want: exitNotFound},
+		{name: "unauthorized and forbidden", errs: []error{unauthorized, forbidden}, want: exitUnauthorized},
+		{name: "conflict", errs: []error{fmt.Errorf("Unable to upload a.json: %w", conflict)}, want: exitConflict},
+		{name: "different kinds", errs: []error{notFound, conflict}, want: exitError},
+		{name: "not an api error", errs: []error{notFound, errors.New("disk full")}, want: exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var report failureReport
+			for _, err := range tt.errs {
+				report.add(err)
+			}
+			if got := report.exitCode(); got != tt.want {
+				t.Errorf("got exit code %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
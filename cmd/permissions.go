@@ -0,0 +1,428 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/platform9/grafanactl/pkg/printer"
+	"github.com/spf13/cobra"
+)
+
+// permissionsFile holds the permissions of a folder, beside its .folder.json file
+const permissionsFile = ".permissions.json"
+
+// permission is an entry of the permissions of a folder or dashboard. Teams and
+// users are referenced by name, so that permissions can be moved between instances.
+type permission struct {
+	Role       string `json:"role,omitempty"`
+	Team       string `json:"team,omitempty"`
+	User       string `json:"user,omitempty"`
+	Permission string `json:"permission"`
+	// Inherited permissions come from the folder of a dashboard, they can't be changed on the dashboard
+	Inherited bool `json:"inherited,omitempty"`
+}
+
+// kind returns what the permission is granted to, and its name
+func (p permission) kind() (string, string) {
+	switch {
+	case p.Team != "":
+		return "team", p.Team
+	case p.User != "":
+		return "user", p.User
+	}
+	return "role", p.Role
+}
+
+func (p permission) String() string {
+	kind, name := p.kind()
+	return fmt.Sprintf("%s %s: %s", kind, name, p.Permission)
+}
+
+var permissionLevels = map[string]int{
+	"View":  client.PermissionView,
+	"Edit":  client.PermissionEdit,
+	"Admin": client.PermissionAdmin,
+}
+
+func permissionName(level int) string {
+	for name, l := range permissionLevels {
+		if l == level {
+			return name
+		}
+	}
+	return strconv.Itoa(level)
+}
+
+// portablePermissions converts the permissions of a folder or dashboard, referencing
+// teams and users by name. Inherited permissions are left out, unless withInherited is set.
+func portablePermissions(remote []client.GrafanaPermission, withInherited bool) []permission {
+	perms := []permission{}
+	for _, item := range remote {
+		if item.Inherited && !withInherited {
+			continue
+		}
+		p := permission{Permission: permissionName(item.Permission), Inherited: item.Inherited}
+		switch {
+		case item.TeamID != 0:
+			p.Team = item.Team
+		case item.UserID != 0:
+			p.User = item.UserLogin
+		default:
+			p.Role = item.Role
+		}
+		perms = append(perms, p)
+	}
+	sortPermissions(perms)
+	return perms
+}
+
+// sortPermissions sorts permissions by what they are granted to, so that they can be compared
+func sortPermissions(perms []permission) {
+	order := map[string]int{"role": 0, "team": 1, "user": 2}
+	sort.SliceStable(perms, func(i, j int) bool {
+		iKind, iName := perms[i].kind()
+		jKind, jName := perms[j].kind()
+		if iKind != jKind {
+			return order[iKind] < order[jKind]
+		}
+		if iName != jName {
+			return iName < jName
+		}
+		return perms[i].Permission < perms[j].Permission
+	})
+}
+
+// permissionsEqual compares two lists of permissions, in any order
+func permissionsEqual(a, b []permission) bool {
+	a = append([]permission{}, a...)
+	b = append([]permission{}, b...)
+	sortPermissions(a)
+	sortPermissions(b)
+	return reflect.DeepEqual(a, b)
+}
+
+// permissionResolver looks up the IDs of the teams and users of permissions by name.
+// Every name is only looked up once. It is safe for concurrent use.
+type permissionResolver struct {
+	c     *client.Client
+	mu    sync.Mutex
+	teams map[string]int64
+	users map[string]int64
+}
+
+func newPermissionResolver(c *client.Client) *permissionResolver {
+	return &permissionResolver{
+		c:     c,
+		teams: map[string]int64{},
+		users: map[string]int64{},
+	}
+}
+
+// resolve turns permissions into the updates sent to grafana.
+// Inherited permissions are skipped, they can't be changed.
+func (r *permissionResolver) resolve(ctx context.Context, perms []permission) ([]client.PermissionUpdate, error) {
+	items := make([]client.PermissionUpdate, 0, len(perms))
+	for _, p := range perms {
+		if p.Inherited {
+			continue
+		}
+		level, ok := permissionLevels[p.Permission]
+		if !ok {
+			kind, name := p.kind()
+			return nil, fmt.Errorf("unknown permission '%s' for %s %s, must be View, Edit or Admin", p.Permission, kind, name)
+		}
+		set := 0
+		for _, name := range []string{p.Role, p.Team, p.User} {
+			if name != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("exactly one of role, team and user must be set for a permission, got %s", p)
+		}
+		item := client.PermissionUpdate{Permission: level}
+		var err error
+		switch {
+		case p.Team != "":
+			item.TeamID, err = r.team(ctx, p.Team)
+		case p.User != "":
+			item.UserID, err = r.user(ctx, p.User)
+		default:
+			item.Role = p.Role
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (r *permissionResolver) team(ctx context.Context, name string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id, ok := r.teams[name]; ok {
+		return id, nil
+	}
+	teams, err := r.c.SearchTeamsWithContext(ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("unable to look up team '%s': %w", name, err)
+	}
+	for _, team := range teams {
+		if team.Name == name {
+			r.teams[name] = team.ID
+			return team.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("team '%s' was not found", name)
+}
+
+func (r *permissionResolver) user(ctx context.Context, login string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id, ok := r.users[login]; ok {
+		return id, nil
+	}
+	users, err := r.c.LookupOrgUsersWithContext(ctx, login)
+	if err != nil {
+		return 0, fmt.Errorf("unable to look up user '%s': %w", login, err)
+	}
+	for _, user := range users {
+		if user.Login == login || user.Email == login {
+			r.users[login] = user.ID
+			return user.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("user '%s' was not found", login)
+}
+
+// readPermissionsFile reads the .permissions.json file of a directory.
+// Nil is returned without a file, the permissions of the folder are left as they are.
+func readPermissionsFile(dir string) ([]permission, error) {
+	path := filepath.Join(dir, permissionsFile)
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read file: %s\nError: %s", path, err)
+	}
+	perms := []permission{}
+	if err = json.Unmarshal(raw, &perms); err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal file: %s\nError: %s", path, err)
+	}
+	return perms, nil
+}
+
+// saveFolderPermissions writes the permissions of a folder to the .permissions.json file of its directory
+func saveFolderPermissions(ctx context.Context, c *client.Client, fol client.GrafanaFolder, dir string) error {
+	remote, err := c.GetFolderPermissionsWithContext(ctx, fol.UID)
+	if err != nil {
+		return fmt.Errorf("unable to get the permissions of folder %s (%s): %w", fol.Title, fol.UID, err)
+	}
+	raw, _ := json.MarshalIndent(portablePermissions(remote, false), "", "  ")
+	path := filepath.Join(dir, permissionsFile)
+	if err = ioutil.WriteFile(path, raw, 0666); err != nil {
+		return fmt.Errorf("Error writing %s: %s", path, err)
+	}
+	return nil
+}
+
+// getPermissions gets the permissions of a folder or dashboard
+func getPermissions(ctx context.Context, c *client.Client, kind, uid string) ([]client.GrafanaPermission, error) {
+	if kind == "folder" {
+		return c.GetFolderPermissionsWithContext(ctx, uid)
+	}
+	return c.GetDashboardPermissionsWithContext(ctx, uid)
+}
+
+// updatePermissions replaces the permissions of a folder or dashboard
+func updatePermissions(ctx context.Context, c *client.Client, kind, uid string, items []client.PermissionUpdate) error {
+	if kind == "folder" {
+		return c.UpdateFolderPermissionsWithContext(ctx, uid, items)
+	}
+	return c.UpdateDashboardPermissionsWithContext(ctx, uid, items)
+}
+
+// permissionsArgs validates the <folder|dashboard> <uid> arguments
+func permissionsArgs(cmd *cobra.Command, args []string) error {
+	if err := cobra.ExactArgs(2)(cmd, args); err != nil {
+		return err
+	}
+	if args[0] != "folder" && args[0] != "dashboard" {
+		return fmt.Errorf("unknown kind '%s', must be folder or dashboard", args[0])
+	}
+	return nil
+}
+
+// permissionsCmd does not do anything, but is needed for scoping of subcommands
+var permissionsCmd = &cobra.Command{
+	Use:   "permissions",
+	Short: "Manage the permissions of folders and dashboards",
+	Long: `Manage the permissions of folders and dashboards
+
+Permissions grant View, Edit or Admin to a role (Viewer or Editor), a team or a
+user. Teams are referenced by name, and users by login or email, so that the
+same permissions can be applied to another grafana instance.
+
+The permissions of a folder can also be kept in a .permissions.json file beside
+its .folder.json file. It is written by 'dashboard download --permissions', and
+applied by 'dashboard upload'.`,
+}
+
+var permissionsGetCmd = &cobra.Command{
+	Use:   "get <folder|dashboard> <uid>",
+	Short: "Show the permissions of a folder or dashboard",
+	Long: `Show the permissions of a folder or dashboard
+
+The permissions of a dashboard include those it inherits from its folder.
+With -o json, the permissions are printed in the format of a .permissions.json file.`,
+	Args: permissionsArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		kind, uid := args[0], args[1]
+		requireAuthParams()
+		c := getGrafanaClient()
+		remote, err := getPermissions(commandContext(), c, kind, uid)
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to get the permissions of %s %s: %w", kind, uid, err))
+		}
+		printList(permissionList(portablePermissions(remote, true)))
+	},
+}
+
+var permissionsSetCmd = &cobra.Command{
+	Use:   "set <folder|dashboard> <uid>",
+	Short: "Replace the permissions of a folder or dashboard",
+	Long: `Replace the permissions of a folder or dashboard
+
+The permissions are read from a file in the format of .permissions.json with
+--file, and from the --role, --team and --user flags, in the form name=permission:
+
+  grafanactl permissions set folder team-a --role Viewer=View --team "Team A"=Admin --user alice=Edit
+
+Permissions which are not given are removed. Inherited permissions of a
+dashboard can only be changed on its folder.`,
+	Args: permissionsArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		kind, uid := args[0], args[1]
+		perms, err := permissionsFromFlags(cmd)
+		if err != nil {
+			exitWithError(err)
+		}
+		requireAuthParams()
+		ctx := commandContext()
+		c := getGrafanaClient()
+		items, err := newPermissionResolver(c).resolve(ctx, perms)
+		if err != nil {
+			exitWithError(err)
+		}
+		if err = updatePermissions(ctx, c, kind, uid, items); err != nil {
+			exitWithError(fmt.Errorf("unable to update the permissions of %s %s: %w", kind, uid, err))
+		}
+		fmt.Printf("Permissions of %s %s updated.\n", kind, uid)
+	},
+}
+
+// permissionsFromFlags reads the permissions given to the set command
+func permissionsFromFlags(cmd *cobra.Command) ([]permission, error) {
+	var perms []permission
+	file, _ := cmd.Flags().GetString("file")
+	if file != "" {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(raw, &perms); err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", file, err)
+		}
+	}
+	for _, kind := range []string{"role", "team", "user"} {
+		values, _ := cmd.Flags().GetStringArray(kind)
+		for _, value := range values {
+			i := strings.LastIndex(value, "=")
+			if i < 1 {
+				return nil, fmt.Errorf("invalid --%s '%s', must be name=permission", kind, value)
+			}
+			p := permission{Permission: value[i+1:]}
+			switch kind {
+			case "role":
+				p.Role = value[:i]
+			case "team":
+				p.Team = value[:i]
+			case "user":
+				p.User = value[:i]
+			}
+			perms = append(perms, p)
+		}
+	}
+	if file == "" && len(perms) == 0 {
+		return nil, fmt.Errorf("no permissions given, use --file, --role, --team or --user")
+	}
+	return perms, nil
+}
+
+// permissionList prints permissions
+type permissionList []permission
+
+func (l permissionList) Columns() []printer.Column {
+	return []printer.Column{
+		{Header: "Type"},
+		{Header: "Name"},
+		{Header: "Permission"},
+		{Header: "Inherited"},
+	}
+}
+
+func (l permissionList) Len() int {
+	return len(l)
+}
+
+func (l permissionList) Row(i int) []string {
+	kind, name := l[i].kind()
+	return []string{kind, name, l[i].Permission, strconv.FormatBool(l[i].Inherited)}
+}
+
+func (l permissionList) Name(i int) string {
+	_, name := l[i].kind()
+	return name
+}
+
+func (l permissionList) Items() interface{} {
+	return []permission(l)
+}
+
+func init() {
+	rootCmd.AddCommand(permissionsCmd)
+	permissionsCmd.AddCommand(permissionsGetCmd)
+	permissionsCmd.AddCommand(permissionsSetCmd)
+
+	permissionsSetCmd.Flags().String("file", "", "File with the permissions, in the format of .permissions.json")
+	permissionsSetCmd.Flags().StringArray("role", []string{}, "Grant a permission to a role, as Role=Permission")
+	permissionsSetCmd.Flags().StringArray("team", []string{}, "Grant a permission to a team, as name=Permission")
+	permissionsSetCmd.Flags().StringArray("user", []string{}, "Grant a permission to a user, as login=Permission")
+}
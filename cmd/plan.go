@@ -0,0 +1,333 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/platform9/grafanactl/pkg/dashboard"
+)
+
+// planAction is what an upload will do with a local folder or dashboard
+type planAction string
+
+const (
+	planCreate    planAction = "create"
+	planUpdate    planAction = "update"
+	planUnchanged planAction = "unchanged"
+	planConflict  planAction = "conflict"
+	planDelete    planAction = "delete"
+	planKeep      planAction = "keep"
+)
+
+var planSymbols = map[planAction]string{
+	planCreate:    "+",
+	planUpdate:    "~",
+	planUnchanged: "=",
+	planConflict:  "!",
+	planDelete:    "-",
+	planKeep:      "=",
+}
+
+// folderPlan is the planned action for a local folder
+type folderPlan struct {
+	local    *localFolder
+	action   planAction
+	reason   string
+	remoteID int64
+	// permissions replace the permissions of the folder, if permissionsChanged
+	permissions        []client.PermissionUpdate
+	permissionsChanged bool
+}
+
+// dashboardPlan is the planned action for a local dashboard file
+type dashboardPlan struct {
+	local   localDashboard
+	folder  *localFolder
+	action  planAction
+	reason  string
+	changes []dashboard.Change
+	// remoteVersion is the version in grafana of an updated dashboard,
+	// files without a version are saved over it
+	remoteVersion int
+}
+
+// uploadPlan holds every change an upload would make to grafana
+type uploadPlan struct {
+	folders    []folderPlan
+	dashboards []dashboardPlan
+	prune      []pruneItem
+}
+
+// buildUploadPlan compares the local folders and dashboards with grafana,
+// with up to parallel requests at once. The dashboards are compared once
+// both sides are normalized with opts.
+func buildUploadPlan(ctx context.Context, c *client.Client, folders []*localFolder, overwrite bool, parallel int, opts dashboard.NormalizeOptions) (uploadPlan, error) {
+	var (
+		plan     uploadPlan
+		firstErr error
+	)
+	// keep the first error, in the order of the plan
+	setErr := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	plan.folders = make([]folderPlan, len(folders))
+	resolver := newPermissionResolver(c)
+	runParallel(ctx, parallel, len(folders), func(i int) func() {
+		fp, err := planFolder(ctx, c, resolver, folders[i])
+		return func() {
+			plan.folders[i] = fp
+			setErr(err)
+		}
+	})
+	if firstErr == nil {
+		setErr(ctx.Err())
+	}
+	if firstErr != nil {
+		return plan, firstErr
+	}
+
+	// the dashboards are compared once the folder they are in is known
+	var pending []folderPlan
+	for _, fp := range plan.folders {
+		for _, dash := range fp.local.dashboards {
+			plan.dashboards = append(plan.dashboards, dashboardPlan{local: dash})
+			pending = append(pending, fp)
+		}
+	}
+	runParallel(ctx, parallel, len(plan.dashboards), func(i int) func() {
+		dp, err := planDashboard(ctx, c, plan.dashboards[i].local, pending[i], overwrite, opts)
+		return func() {
+			plan.dashboards[i] = dp
+			setErr(err)
+		}
+	})
+	if firstErr == nil {
+		setErr(ctx.Err())
+	}
+	return plan, firstErr
+}
+
+func planFolder(ctx context.Context, c *client.Client, resolver *permissionResolver, fol *localFolder) (folderPlan, error) {
+	fp := folderPlan{local: fol, action: planUnchanged}
+	// The "General" folder always exists, and has ID of 0
+	if fol.folder == nil {
+		return fp, nil
+	}
+	remote, err := c.GetFolderWithContext(ctx, fol.folder.UID)
+	switch {
+	case client.IsNotFound(err):
+		fp.action = planCreate
+	case err != nil:
+		return fp, fmt.Errorf("Could not check if folder %s exists: %w", fol.folder.UID, err)
+	case remote.ParentUID != fol.folder.ParentUID:
+		fp.action = planUpdate
+		fp.reason = fmt.Sprintf("moved from %s", parentDescription(remote))
+	case remote.Title != fol.folder.Title:
+		fp.action = planUpdate
+	}
+	fp.remoteID = remote.ID
+	if fol.permissions == nil {
+		return fp, nil
+	}
+
+	// The permissions of a new folder are always set, as grafana gives it default permissions
+	if fp.action != planCreate {
+		current, err := c.GetFolderPermissionsWithContext(ctx, fol.folder.UID)
+		if err != nil {
+			return fp, fmt.Errorf("Could not get the permissions of folder %s: %w", fol.folder.UID, err)
+		}
+		if permissionsEqual(portablePermissions(current, false), fol.permissions) {
+			return fp, nil
+		}
+		if fp.action == planUnchanged {
+			fp.action = planUpdate
+			fp.reason = "permissions changed"
+		}
+	}
+	if fp.permissions, err = resolver.resolve(ctx, fol.permissions); err != nil {
+		return fp, fmt.Errorf("Invalid permissions for folder %s: %w", fol.folder.UID, err)
+	}
+	fp.permissionsChanged = true
+	return fp, nil
+}
+
+// parentDescription describes the folder a remote folder is nested in, for the plan
+func parentDescription(remote client.GrafanaFolder) string {
+	if remote.ParentUID == "" {
+		return "the top level"
+	}
+	for _, parent := range remote.Parents {
+		if parent.UID == remote.ParentUID {
+			return fmt.Sprintf("folder '%s'", parent.Title)
+		}
+	}
+	return fmt.Sprintf("folder %s", remote.ParentUID)
+}
+
+// comparableDashboard returns a copy of a dashboard normalized with opts, like a downloaded file,
+// and without the fields specific to a grafana instance
+func comparableDashboard(dash map[string]interface{}, opts dashboard.NormalizeOptions) map[string]interface{} {
+	var copied map[string]interface{}
+	raw, _ := json.Marshal(dash)
+	_ = json.Unmarshal(raw, &copied)
+	dashboard.Normalize(copied, opts)
+	return client.NormalizeDashboard(copied)
+}
+
+func planDashboard(ctx context.Context, c *client.Client, dash localDashboard, fp folderPlan, overwrite bool, opts dashboard.NormalizeOptions) (dashboardPlan, error) {
+	var (
+		remote    client.GrafanaDashboardFullWithMeta
+		remoteRaw []byte
+		remoteMap map[string]interface{}
+		err       error
+	)
+	dp := dashboardPlan{local: dash, folder: fp.local, action: planCreate}
+	if dash.uid() == "" {
+		return dp, nil
+	}
+	remote, err = c.GetDashboardWithContext(ctx, dash.uid())
+	if client.IsNotFound(err) {
+		return dp, nil
+	}
+	if err != nil {
+		return dp, fmt.Errorf("Could not check if dashboard %s exists: %w", dash.uid(), err)
+	}
+	remoteRaw, _ = remote.Dashboard.MarshalJSON()
+	_ = json.Unmarshal(remoteRaw, &remoteMap)
+	// a downloaded file is normalized, the remote dashboard is normalized the same way to compare them
+	remoteMap = comparableDashboard(remoteMap, opts)
+	localMap := comparableDashboard(dash.contents, opts)
+
+	// a folder that doesn't exist yet never holds the remote dashboard
+	sameFolder := fp.action != planCreate && remote.Meta.FolderId == fp.remoteID
+	if reflect.DeepEqual(remoteMap, localMap) && sameFolder {
+		dp.action = planUnchanged
+		return dp, nil
+	}
+	// files without a version were normalized, they can't be checked for conflicts
+	if !overwrite && dash.version() != 0 && remote.Meta.Version != dash.version() {
+		dp.action = planConflict
+		dp.reason = fmt.Sprintf("changed in grafana (version %d) since this file was saved (version %d)", remote.Meta.Version, dash.version())
+		return dp, nil
+	}
+	dp.action = planUpdate
+	dp.remoteVersion = remote.Meta.Version
+	if !sameFolder {
+		dp.reason = fmt.Sprintf("moved from folder '%s'", remote.Meta.FolderTitle)
+	}
+	dp.changes = dashboard.Diff(remoteMap, localMap)
+	return dp, nil
+}
+
+// count returns how many folders and dashboards will have an action taken on them
+func (p uploadPlan) count(action planAction) int {
+	count := 0
+	for _, fp := range p.folders {
+		if fp.action == action && fp.local.folder != nil {
+			count++
+		}
+	}
+	for _, dp := range p.dashboards {
+		if dp.action == action {
+			count++
+		}
+	}
+	for _, item := range p.prune {
+		if action == planDelete && item.keep == "" {
+			count++
+		}
+	}
+	return count
+}
+
+func (p uploadPlan) hasChanges() bool {
+	return p.count(planCreate)+p.count(planUpdate)+p.count(planConflict)+p.count(planDelete) > 0
+}
+
+// countUnresolved counts the datasource references of the dashboards that could not be resolved
+func (p uploadPlan) countUnresolved() int {
+	n := 0
+	for _, dp := range p.dashboards {
+		n += len(dp.local.unresolved)
+	}
+	return n
+}
+
+// print writes a human readable description of the plan to stdout
+func (p uploadPlan) print() {
+	fmt.Println("Folders:")
+	for _, fp := range p.folders {
+		if fp.local.folder == nil {
+			continue
+		}
+		line := fmt.Sprintf("  %s %-9s %s", planSymbols[fp.action], fp.action, fp.local)
+		if fp.reason != "" {
+			line = fmt.Sprintf("%s: %s", line, fp.reason)
+		}
+		fmt.Println(line)
+	}
+	fmt.Println("Dashboards:")
+	for _, dp := range p.dashboards {
+		line := fmt.Sprintf("  %s %-9s %s", planSymbols[dp.action], dp.action, dp.local)
+		if dp.reason != "" {
+			line = fmt.Sprintf("%s: %s", line, dp.reason)
+		}
+		fmt.Println(line)
+		for _, unresolved := range dp.local.unresolved {
+			fmt.Printf("                ? %s\n", unresolved)
+		}
+		for _, change := range dp.changes {
+			fmt.Printf("                %s\n", change)
+		}
+	}
+	if len(p.prune) > 0 {
+		fmt.Println("Prune:")
+		for _, item := range p.prune {
+			if item.keep != "" {
+				fmt.Printf("  %s %-9s %s: %s\n", planSymbols[planKeep], planKeep, item, item.keep)
+				continue
+			}
+			fmt.Printf("  %s %-9s %s\n", planSymbols[planDelete], planDelete, item)
+		}
+	}
+	if n := p.countUnresolved(); n > 0 {
+		fmt.Printf("Warning: %d datasource references could not be resolved, the panels using them will not work.\n", n)
+	}
+	fmt.Printf("Plan: %d to create, %d to update, %d unchanged, %d in conflict, %d to delete.\n",
+		p.count(planCreate), p.count(planUpdate), p.count(planUnchanged), p.count(planConflict), p.count(planDelete))
+}
+
+// confirm asks the user a yes/no question on stdin
+func confirm(question string) bool {
+	fmt.Printf("%s Only 'yes' will be accepted to approve.\n  Enter a value: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		fmt.Println()
+		return false
+	}
+	return strings.TrimSpace(answer) == "yes"
+}
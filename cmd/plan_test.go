@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/platform9/grafanactl/pkg/dashboard"
+)
+
+// dashboardServer serves a single dashboard, at the given version, by its UID.
+// The caller closes the server.
+func dashboardServer(remote map[string]interface{}, version int) (*client.Client, *httptest.Server) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/dashboards/uid/"+remote["uid"].(string) {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"dashboard": remote,
+			"meta":      map[string]interface{}{"version": version, "folderId": 0},
+		})
+	}))
+	return client.NewClient(srv.URL, "key", srv.Client()), srv
+}
+
+// downloadedDashboard normalizes a dashboard with opts like download does, and reads it back like upload does
+func downloadedDashboard(t *testing.T, dash map[string]interface{}, opts dashboard.NormalizeOptions) localDashboard {
+	t.Helper()
+	raw, _ := json.Marshal(dash)
+	decoded, err := dashboard.Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dashboard.Normalize(decoded, opts)
+	raw, err = dashboard.Format(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := localDashboard{path: "d1.json"}
+	if err = json.Unmarshal(raw, &local.contents); err != nil {
+		t.Fatal(err)
+	}
+	return local
+}
+
+func TestPlanDashboardConflicts(t *testing.T) {
+	saved := map[string]interface{}{"id": 7, "uid": "d1", "title": "Saved", "version": 3.0, "panels": []interface{}{}}
+	remote := map[string]interface{}{"id": 7, "uid": "d1", "title": "Changed in grafana", "version": 4, "panels": []interface{}{}}
+	general := folderPlan{local: &localFolder{}, action: planUnchanged}
+
+	tests := []struct {
+		name      string
+		local     localDashboard
+		overwrite bool
+		want      planAction
+	}{
+		{name: "file of an older version", local: localDashboard{path: "d1.json", contents: saved}, want: planConflict},
+		{name: "overwrite", local: localDashboard{path: "d1.json", contents: saved}, overwrite: true, want: planUpdate},
+		// normalized files have no version, they are saved over the version in grafana
+		{name: "normalized file", local: downloadedDashboard(t, saved, dashboard.NormalizeOptions{Strip: dashboard.DefaultStrip}), want: planUpdate},
+		{name: "file without a version", local: localDashboard{path: "d1.json", contents: map[string]interface{}{
+			"uid": "d1", "title": "Generated", "panels": []interface{}{},
+		}}, want: planUpdate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := dashboardServer(remote, 4)
+			defer srv.Close()
+			dp, err := planDashboard(context.Background(), c, tt.local, general, tt.overwrite, dashboard.NormalizeOptions{Strip: dashboard.DefaultStrip})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dp.action != tt.want {
+				t.Errorf("planned %s (%s), want %s", dp.action, dp.reason, tt.want)
+			}
+		})
+	}
+
+	t.Run("file at the remote version", func(t *testing.T) {
+		c, srv := dashboardServer(remote, 3)
+		defer srv.Close()
+		dp, err := planDashboard(context.Background(), c, localDashboard{path: "d1.json", contents: saved}, general, false, dashboard.NormalizeOptions{Strip: dashboard.DefaultStrip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dp.action != planUpdate {
+			t.Errorf("planned %s (%s), want %s", dp.action, dp.reason, planUpdate)
+		}
+	})
+}
+
+func TestUploadNormalizedDashboard(t *testing.T) {
+	g := &versionedGrafana{dashboards: map[string]map[string]interface{}{
+		"d1": {"uid": "d1", "title": "Changed in grafana", "version": 4, "panels": []interface{}{}},
+	}}
+	c, srv := g.client()
+	defer srv.Close()
+	general := folderPlan{local: &localFolder{}, action: planUnchanged}
+	local := downloadedDashboard(t, map[string]interface{}{"uid": "d1", "title": "Saved", "version": 3, "panels": []interface{}{}}, dashboard.NormalizeOptions{Strip: dashboard.DefaultStrip})
+	dp, err := planDashboard(context.Background(), c, local, general, false, dashboard.NormalizeOptions{Strip: dashboard.DefaultStrip})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failures failureReport
+	plan := uploadPlan{folders: []folderPlan{general}, dashboards: []dashboardPlan{dp}}
+	if uploaded := applyUploadPlan(context.Background(), c, plan, false, 1, "", &failures); uploaded != 1 || failures.len() > 0 {
+		t.Fatalf("uploaded %d dashboards with failures %v, want the dashboard to be saved over version 4", uploaded, failures.errs)
+	}
+	if got := g.dashboards["d1"]; got["title"] != "Saved" || got["version"] != 5 {
+		t.Errorf("got %v at version %v, want Saved at version 5", got["title"], got["version"])
+	}
+}
+
+func TestCompareDownloadedDashboard(t *testing.T) {
+	remote := map[string]interface{}{"id": 7, "uid": "d1", "title": "Saved", "version": 4, "panels": []interface{}{
+		map[string]interface{}{"id": 12, "type": "graph", "pluginVersion": "7.3.1"},
+		map[string]interface{}{"id": 5, "type": "row", "panels": []interface{}{
+			map[string]interface{}{"id": 9, "type": "stat", "pluginVersion": "7.3.1"},
+		}},
+	}}
+	opts := dashboard.NormalizeOptions{
+		Strip:          append([]string{"panels.*.pluginVersion", "panels.*.panels.*.pluginVersion"}, dashboard.DefaultStrip...),
+		RenumberPanels: true,
+	}
+	local := downloadedDashboard(t, remote, opts)
+
+	t.Run("plan", func(t *testing.T) {
+		c, srv := dashboardServer(remote, 4)
+		defer srv.Close()
+		general := folderPlan{local: &localFolder{}, action: planUnchanged}
+		dp, err := planDashboard(context.Background(), c, local, general, false, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dp.action != planUnchanged {
+			t.Errorf("planned %s with changes %v, want a fresh download to be unchanged", dp.action, dp.changes)
+		}
+	})
+
+	t.Run("diff", func(t *testing.T) {
+		from := dashboardSet{name: "grafana", dashboards: map[string]diffEntry{"d1": {folder: "General", contents: remote}}}
+		to := dashboardSet{name: ".", dashboards: map[string]diffEntry{"d1": {folder: "General", contents: local.contents}}}
+		if drift := printDashboardDiff(from, to, "structural", opts); drift != 0 {
+			t.Errorf("found %d dashboards with drift, want a fresh download to have none", drift)
+		}
+	})
+}
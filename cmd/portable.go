@@ -0,0 +1,127 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/platform9/grafanactl/pkg/dashboard"
+	"github.com/spf13/cobra"
+)
+
+// portableExporter converts downloaded dashboards to the format of grafana's "Export for sharing externally"
+type portableExporter struct {
+	datasources []client.GrafanaDataSource
+	// version is the version of grafana, empty if it is unknown
+	version string
+}
+
+// newPortableExporter lists the datasources of the organization of c, which the exported dashboards reference
+func newPortableExporter(ctx context.Context, c *client.Client) (*portableExporter, error) {
+	datasources, err := c.GetAllDataSourcesWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the datasources of the portable dashboards: %w", err)
+	}
+	e := &portableExporter{datasources: datasources}
+	// the version is only informational, it is left out if grafana doesn't tell
+	if health, err := c.GetHealthWithContext(ctx); err == nil {
+		e.version = health.Version
+	}
+	return e, nil
+}
+
+// export converts a dashboard, and returns the datasource references that were not found
+func (e *portableExporter) export(raw []byte) ([]byte, []dashboard.UnresolvedDataSource, error) {
+	dash, err := dashboard.Decode(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	unresolved := dashboard.MakePortable(dash, func(ref dashboard.DataSourceRef) (dashboard.ExportedDataSource, bool) {
+		ds, found := lookupDataSource(e.datasources, ref.String())
+		return dashboard.ExportedDataSource{Name: ds.Name, Type: ds.Type, TypeName: ds.TypeName}, found
+	}, e.version)
+	raw, err = json.Marshal(dash)
+	return raw, unresolved, err
+}
+
+// readInputs reads the --inputs flags, the values of the inputs of portable dashboards by name
+func readInputs(cmd *cobra.Command) (map[string]string, error) {
+	inputs := map[string]string{}
+	values, _ := cmd.Flags().GetStringArray("inputs")
+	for _, input := range values {
+		parts := strings.SplitN(input, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid --inputs '%s', must be name=value", input)
+		}
+		inputs[parts[0]] = parts[1]
+	}
+	return inputs, nil
+}
+
+// resolveInputs resolves the inputs of a portable dashboard with the values of --inputs.
+// Datasource inputs without a value use the datasource named by their label, the datasource
+// the dashboard was exported with, and constants their default value. Datasources are sent
+// to grafana by UID, if they have one, as references by UID and by name both accept a UID.
+// The contents of the dashboard are replaced with the dashboard as grafana imports it,
+// so that it can be compared with grafana.
+func resolveInputs(dash *localDashboard, values map[string]string, targets []client.GrafanaDataSource) error {
+	var missing []string
+	resolved := map[string]string{}
+	for _, input := range dashboard.Inputs(dash.contents) {
+		value, ok := values[input.Name]
+		switch {
+		case input.Type == "datasource":
+			if !ok {
+				value = input.Label
+			}
+			// without the datasources of grafana, the value is used as it is
+			if targets == nil {
+				break
+			}
+			ds, found := lookupDataSource(targets, value)
+			if !found {
+				missing = append(missing, fmt.Sprintf("%s (datasource '%s' was not found)", input.Name, value))
+				continue
+			}
+			value = ds.Name
+			if ds.UID != "" {
+				value = ds.UID
+			}
+		case !ok && input.Value != "":
+			value = input.Value
+		case !ok:
+			missing = append(missing, fmt.Sprintf("%s (%s)", input.Name, input.Label))
+			continue
+		}
+		resolved[input.Name] = value
+		dash.inputs = append(dash.inputs, client.DashboardImportInput{
+			Name:     input.Name,
+			Type:     input.Type,
+			PluginID: input.PluginID,
+			Value:    value,
+		})
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s: no value for the inputs %s, set them with --inputs name=value", dash.path, strings.Join(missing, ", "))
+	}
+	dash.portable = dash.contents
+	dash.contents = dashboard.ResolveInputs(dash.contents, resolved)
+	return nil
+}
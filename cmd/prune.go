@@ -0,0 +1,217 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/platform9/grafanactl/pkg/client"
+)
+
+// pruneItem is a folder or dashboard in grafana without a local counterpart
+type pruneItem struct {
+	kind     string
+	uid      string
+	title    string
+	folderID int64
+	// keep is the reason the item is protected from pruning, if any
+	keep string
+}
+
+func (p pruneItem) String() string {
+	return fmt.Sprintf("%s %s (%s)", p.kind, p.title, p.uid)
+}
+
+// pruneRules protect remote dashboards and folders from being pruned
+type pruneRules struct {
+	protectedTags    []string
+	protectedFolders []string
+}
+
+func (r pruneRules) isProtectedFolder(uid, title string) bool {
+	for _, protected := range r.protectedFolders {
+		if protected == uid || protected == title {
+			return true
+		}
+	}
+	return false
+}
+
+func (r pruneRules) protectedTag(tags []string) string {
+	for _, tag := range tags {
+		for _, protected := range r.protectedTags {
+			if tag == protected {
+				return tag
+			}
+		}
+	}
+	return ""
+}
+
+// buildPrunePlan finds the dashboards and folders in grafana which are not in the upload plan
+func buildPrunePlan(ctx context.Context, c *client.Client, plan uploadPlan, rules pruneRules) ([]pruneItem, error) {
+	var (
+		prune   []pruneItem
+		folders []client.GrafanaFolder
+		results []client.GrafanaSearchHit
+		err     error
+	)
+	localFolders := map[string]bool{}
+	// folders holding folders that are kept must be kept too,
+	// deleting a folder deletes the folders nested in it
+	keptParents := map[string]bool{}
+	for _, fp := range plan.folders {
+		if fp.local.folder != nil {
+			localFolders[fp.local.folder.UID] = true
+			keptParents[fp.local.folder.ParentUID] = true
+		}
+	}
+	localDashboards := map[string]bool{}
+	for _, dp := range plan.dashboards {
+		localDashboards[dp.local.uid()] = true
+	}
+
+	if folders, err = c.GetAllFoldersWithContext(ctx); err != nil {
+		return nil, fmt.Errorf("error downloading folders: %w", err)
+	}
+	// the folders nested in a protected folder are protected as well,
+	// parents are listed before their children
+	protectedFolderIDs := map[int64]bool{}
+	protectedUIDs := map[string]bool{}
+	for _, fol := range folders {
+		if rules.isProtectedFolder(fol.UID, fol.Title) || protectedUIDs[fol.ParentUID] {
+			protectedFolderIDs[fol.ID] = true
+			protectedUIDs[fol.UID] = true
+		}
+	}
+
+	// folders holding dashboards that are kept must be kept too,
+	// deleting a folder deletes the dashboards in it
+	keptFolderIDs := map[int64]bool{}
+	if results, err = c.SearchAllDashboardsWithContext(ctx, url.Values{}); err != nil {
+		return nil, fmt.Errorf("error searching dashboards: %w", err)
+	}
+	for _, hit := range results {
+		if localDashboards[hit.UID] {
+			continue
+		}
+		item := pruneItem{kind: "dashboard", uid: hit.UID, title: hit.Title}
+		if tag := rules.protectedTag(hit.Tags); tag != "" {
+			item.keep = fmt.Sprintf("protected tag '%s'", tag)
+		} else if protectedFolderIDs[hit.FolderID] {
+			item.keep = fmt.Sprintf("protected folder '%s'", hit.FolderTitle)
+		} else {
+			// provisioned dashboards are managed by files on the grafana server
+			dash, err := c.GetDashboardWithContext(ctx, hit.UID)
+			if err != nil {
+				return nil, fmt.Errorf("error downloading dashboard %s: %w", hit.UID, err)
+			}
+			if dash.Meta.Provisioned {
+				item.keep = "provisioned"
+			}
+		}
+		if item.keep != "" {
+			keptFolderIDs[hit.FolderID] = true
+		}
+		prune = append(prune, item)
+	}
+
+	// children are visited before their parents, so that their parents know if they are kept
+	var folderItems []pruneItem
+	for i := len(folders) - 1; i >= 0; i-- {
+		fol := folders[i]
+		if localFolders[fol.UID] {
+			continue
+		}
+		item := pruneItem{kind: "folder", uid: fol.UID, title: fol.Title, folderID: fol.ID}
+		if protectedFolderIDs[fol.ID] {
+			item.keep = "protected folder"
+		} else if keptFolderIDs[fol.ID] {
+			item.keep = "holds protected dashboards"
+		} else if keptParents[fol.UID] {
+			item.keep = "holds kept folders"
+		}
+		if item.keep != "" {
+			keptParents[fol.ParentUID] = true
+		}
+		folderItems = append(folderItems, item)
+	}
+	// parents are listed before their children
+	for i := len(folderItems) - 1; i >= 0; i-- {
+		prune = append(prune, folderItems[i])
+	}
+	return prune, nil
+}
+
+// applyPrune deletes the dashboards, then the folders, of a prune plan.
+// Errors are added to the failure report.
+// Returns the number of items which were deleted.
+func applyPrune(ctx context.Context, c *client.Client, prune []pruneItem, failures *failureReport) int {
+	deleted := map[string]bool{}
+	for _, item := range prune {
+		if item.kind != "dashboard" || item.keep != "" {
+			continue
+		}
+		if ctx.Err() != nil {
+			return len(deleted)
+		}
+		if err := c.DeleteDashboardWithContext(ctx, item.uid); err != nil {
+			failures.addf("Unable to delete %s: %w", item, err)
+			continue
+		}
+		deleted[item.uid] = true
+		fmt.Printf("Deleted %s\n", item)
+	}
+	// nested folders are deleted before their parents, which are listed first
+	for i := len(prune) - 1; i >= 0; i-- {
+		item := prune[i]
+		if item.kind != "folder" || item.keep != "" {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		// Only delete folders which are empty by now, an upload to
+		// the folder may have failed, leaving a dashboard in it.
+		query := url.Values{}
+		query.Add("folderIds", strconv.FormatInt(item.folderID, 10))
+		results, err := c.SearchDashboardsWithContext(ctx, query)
+		if err != nil {
+			failures.addf("Unable to check the contents of %s: %w", item, err)
+			continue
+		}
+		empty := true
+		for _, hit := range results {
+			if !deleted[hit.UID] {
+				empty = false
+			}
+		}
+		if !empty {
+			failures.addf("Not deleting %s, it still holds dashboards", item)
+			continue
+		}
+		if err := c.DeleteFolderWithContext(ctx, item.uid); err != nil {
+			failures.addf("Unable to delete %s: %w", item, err)
+			continue
+		}
+		deleted[item.uid] = true
+		fmt.Printf("Deleted %s\n", item)
+	}
+	return len(deleted)
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/platform9/grafanactl/pkg/client"
+)
+
+// fakeGrafana serves the folders and dashboards a prune lists, and records what is deleted
+type fakeGrafana struct {
+	mu         sync.Mutex
+	folders    []client.GrafanaFolder
+	dashboards []client.GrafanaSearchHit
+	deleted    []string
+}
+
+func (g *fakeGrafana) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	query := r.URL.Query()
+	// everything fits on the first page
+	if page := query.Get("page"); page != "" && page != "1" {
+		json.NewEncoder(w).Encode([]interface{}{})
+		return
+	}
+	switch {
+	case r.URL.Path == "/api/folders":
+		children := []client.GrafanaFolder{}
+		for _, fol := range g.folders {
+			if fol.ParentUID == query.Get("parentUid") {
+				children = append(children, fol)
+			}
+		}
+		json.NewEncoder(w).Encode(children)
+	case r.URL.Path == "/api/search":
+		hits := []client.GrafanaSearchHit{}
+		for _, hit := range g.dashboards {
+			if ids := query.Get("folderIds"); ids == "" || ids == strconv.FormatInt(hit.FolderID, 10) {
+				hits = append(hits, hit)
+			}
+		}
+		json.NewEncoder(w).Encode(hits)
+	case strings.HasPrefix(r.URL.Path, "/api/dashboards/uid/") && r.Method == http.MethodGet:
+		uid := strings.TrimPrefix(r.URL.Path, "/api/dashboards/uid/")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"dashboard": map[string]interface{}{"uid": uid},
+			"meta":      map[string]interface{}{},
+		})
+	case r.Method == http.MethodDelete:
+		uid := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		g.deleted = append(g.deleted, uid)
+		// grafana deletes the folders nested in a deleted folder along with it
+		for _, fol := range g.folders {
+			if fol.UID == uid {
+				g.removeFolder(uid)
+			}
+		}
+		for i, hit := range g.dashboards {
+			if hit.UID == uid {
+				g.dashboards = append(g.dashboards[:i], g.dashboards[i+1:]...)
+				break
+			}
+		}
+		w.Write([]byte("{}"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// removeFolder removes a folder and the folders nested in it
+func (g *fakeGrafana) removeFolder(uid string) {
+	kept := g.folders[:0]
+	var children []string
+	for _, fol := range g.folders {
+		switch {
+		case fol.UID == uid:
+		case fol.ParentUID == uid:
+			children = append(children, fol.UID)
+			kept = append(kept, fol)
+		default:
+			kept = append(kept, fol)
+		}
+	}
+	g.folders = kept
+	for _, child := range children {
+		g.removeFolder(child)
+	}
+}
+
+// client starts serving g, the caller closes the server
+func (g *fakeGrafana) client() (*client.Client, *httptest.Server) {
+	srv := httptest.NewServer(g)
+	return client.NewClient(srv.URL, "key", srv.Client()), srv
+}
+
+// nestedFakeGrafana has the folders top > middle > bottom, and a dashboard in bottom
+func nestedFakeGrafana() *fakeGrafana {
+	return &fakeGrafana{
+		folders: []client.GrafanaFolder{
+			{ID: 1, UID: "top", Title: "Top"},
+			{ID: 2, UID: "middle", Title: "Middle", ParentUID: "top"},
+			{ID: 3, UID: "bottom", Title: "Bottom", ParentUID: "middle"},
+		},
+		dashboards: []client.GrafanaSearchHit{
+			{UID: "deep", Title: "Deep", FolderID: 3, FolderTitle: "Bottom"},
+		},
+	}
+}
+
+// pruneActions returns the items of a prune plan, as uid=reason for kept items and uid for deleted ones
+func pruneActions(prune []pruneItem) []string {
+	var actions []string
+	for _, item := range prune {
+		if item.keep != "" {
+			actions = append(actions, item.uid+"="+item.keep)
+			continue
+		}
+		actions = append(actions, item.uid)
+	}
+	return actions
+}
+
+func TestPruneNestedFolders(t *testing.T) {
+	g := nestedFakeGrafana()
+	c, srv := g.client()
+	defer srv.Close()
+	prune, err := buildPrunePlan(context.Background(), c, uploadPlan{}, pruneRules{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// parents are listed before their children
+	if got, want := strings.Join(pruneActions(prune), ","), "deep,top,middle,bottom"; got != want {
+		t.Fatalf("planned %s, want %s", got, want)
+	}
+
+	var failures failureReport
+	if deleted := applyPrune(context.Background(), c, prune, &failures); deleted != 4 || failures.len() != 0 {
+		t.Fatalf("deleted %d items with %d failures, want 4 and none", deleted, failures.len())
+	}
+	// children are deleted before their parents, or they would be gone with them
+	if got, want := strings.Join(g.deleted, ","), "deep,bottom,middle,top"; got != want {
+		t.Errorf("deleted %s, want %s", got, want)
+	}
+}
+
+func TestPruneKeepsParentsOfKeptFolders(t *testing.T) {
+	tests := []struct {
+		name  string
+		plan  uploadPlan
+		rules pruneRules
+		want  string
+	}{
+		{
+			name:  "protected folder",
+			rules: pruneRules{protectedFolders: []string{"middle"}},
+			want:  "deep=protected folder 'Bottom',top=holds kept folders,middle=protected folder,bottom=protected folder",
+		},
+		{
+			name:  "protected dashboard",
+			rules: pruneRules{protectedTags: []string{"keep"}},
+			want:  "deep=protected tag 'keep',top=holds kept folders,middle=holds kept folders,bottom=holds protected dashboards",
+		},
+		{
+			name: "local folder",
+			plan: uploadPlan{folders: []folderPlan{{local: &localFolder{
+				folder: &client.GrafanaFolder{UID: "middle", ParentUID: "top"},
+			}}}},
+			want: "deep,top=holds kept folders,bottom",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := nestedFakeGrafana()
+			g.dashboards[0].Tags = []string{"keep"}
+			c, srv := g.client()
+			defer srv.Close()
+			prune, err := buildPrunePlan(context.Background(), c, tt.plan, tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(pruneActions(prune), ","); got != tt.want {
+				t.Errorf("planned %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -16,10 +16,20 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/platform9/grafanactl/pkg/printer"
 	"github.com/spf13/cobra"
 
 	homedir "github.com/mitchellh/go-homedir"
@@ -28,6 +38,15 @@ import (
 
 var cfgFile string
 
+// Exit codes, so that scripts can tell kinds of failures apart.
+// The diff command also exits with 1 when it finds differences, and 2 on errors.
+const (
+	exitError        = 1
+	exitUnauthorized = 3
+	exitNotFound     = 4
+	exitConflict     = 5
+)
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "grafanactl",
@@ -38,6 +57,11 @@ multiple grafana instances, or organizations.
 You can download dashboards for a specific org, or folder.
 
 You can upload dashboards to a specific org, preserving folder structure.`,
+	// Flags are bound to viper by name, and several subcommands share flag names.
+	// Re-bind the flags of the command being run, so viper reads the right values.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlags(cmd.Flags())
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -45,7 +69,7 @@ You can upload dashboards to a specific org, preserving folder structure.`,
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 }
 
@@ -63,6 +87,35 @@ func init() {
 	// `url` command option for grafana URL
 	rootCmd.PersistentFlags().String("url", "", "The URL of a Grafana instance")
 	viper.BindPFlag("url", rootCmd.PersistentFlags().Lookup("url"))
+	// `context` command option for selecting one of the contexts in the config file
+	rootCmd.PersistentFlags().String("context", "", "The name of the config file context to use")
+	viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+	// `org-id` and `org-name` select the organization to act on, instead of the one of the user or API key
+	rootCmd.PersistentFlags().Int64("org-id", 0, "The ID of the Grafana organization to act on")
+	viper.BindPFlag("org-id", rootCmd.PersistentFlags().Lookup("org-id"))
+	rootCmd.PersistentFlags().String("org-name", "", "The name of the Grafana organization to act on")
+	viper.BindPFlag("org-name", rootCmd.PersistentFlags().Lookup("org-name"))
+
+	// Requests that fail with a temporary error, such as HTTP 429 or 503, are retried
+	rootCmd.PersistentFlags().Int("retry-max-attempts", 3, "Number of times a request which failed with a temporary error is attempted, 1 to never retry")
+	viper.BindPFlag("retry-max-attempts", rootCmd.PersistentFlags().Lookup("retry-max-attempts"))
+	rootCmd.PersistentFlags().Duration("retry-min-backoff", 500*time.Millisecond, "Delay before retrying a request, doubled on every retry")
+	viper.BindPFlag("retry-min-backoff", rootCmd.PersistentFlags().Lookup("retry-min-backoff"))
+	rootCmd.PersistentFlags().Duration("retry-max-backoff", 30*time.Second, "Maximum delay before retrying a request")
+	viper.BindPFlag("retry-max-backoff", rootCmd.PersistentFlags().Lookup("retry-max-backoff"))
+	rootCmd.PersistentFlags().Bool("retry-non-idempotent", false, "Also retry requests which create or change resources after a server or connection error, they may be applied twice")
+	viper.BindPFlag("retry-non-idempotent", rootCmd.PersistentFlags().Lookup("retry-non-idempotent"))
+	// Client side rate limiting, to stay below the limits of the server
+	rootCmd.PersistentFlags().Float64("rate-limit", 0, "Maximum number of requests per second, 0 for no limit")
+	viper.BindPFlag("rate-limit", rootCmd.PersistentFlags().Lookup("rate-limit"))
+	rootCmd.PersistentFlags().Int("rate-limit-burst", 1, "Number of requests which may be sent at once, above the rate limit")
+	viper.BindPFlag("rate-limit-burst", rootCmd.PersistentFlags().Lookup("rate-limit-burst"))
+
+	// Output format of the commands which list resources
+	rootCmd.PersistentFlags().StringP("output", "o", "table", fmt.Sprintf("Output format of lists: %s", strings.Join(printer.Formats, ", ")))
+	viper.BindPFlag("output", rootCmd.PersistentFlags().Lookup("output"))
+	rootCmd.PersistentFlags().String("template", "", "Template of the template and jsonpath output formats")
+	viper.BindPFlag("template", rootCmd.PersistentFlags().Lookup("template"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -75,7 +128,7 @@ func initConfig() {
 		home, err := homedir.Dir()
 		if err != nil {
 			fmt.Println(err)
-			os.Exit(1)
+			os.Exit(exitError)
 		}
 
 		viper.SetConfigName(".grafanactl.yaml")
@@ -86,8 +139,9 @@ func initConfig() {
 	}
 
 	// Environment Variables expect to be the uppercase form of the flag name
-	// env vars must be in the form GRAFANA_VARNAME
+	// env vars must be in the form GRAFANA_VARNAME, with dashes replaced by underscores
 	viper.SetEnvPrefix("GRAFANA")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
@@ -99,21 +153,192 @@ func initConfig() {
 	}
 }
 
+// commandContext returns a context which is cancelled when the command is
+// interrupted, so that bulk operations can stop cleanly between requests.
+// A second interrupt exits immediately.
+func commandContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		fmt.Fprintln(os.Stderr, "\nInterrupted, stopping. Interrupt again to exit immediately.")
+		cancel()
+	}()
+	return ctx
+}
+
+// exitWithError prints an error, and exits with the code matching its kind
+func exitWithError(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	os.Exit(exitCode(err))
+}
+
+// exitCode returns the exit code matching the kind of an error
+func exitCode(err error) int {
+	switch {
+	case client.IsUnauthorized(err), client.IsForbidden(err):
+		return exitUnauthorized
+	case client.IsNotFound(err):
+		return exitNotFound
+	case client.IsVersionMismatch(err):
+		return exitConflict
+	}
+	return exitError
+}
+
+// printList prints a list of resources to stdout, in the format of the --output flag
+func printList(list printer.List) {
+	p, err := printer.New(viper.GetString("output"), viper.GetString("template"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(exitError)
+	}
+	if err = p.Print(os.Stdout, list); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(exitError)
+	}
+}
+
 // Ensures that the global authentication parameters are specified
 // Will exit if they are not
 func requireAuthParams() {
-	if !viper.IsSet("url") {
+	settings, err := getGrafanaSettings()
+	if err != nil {
+		exitWithError(err)
+	}
+	if settings.URL == "" {
 		fmt.Fprintln(os.Stderr, "Error: Grafana URL not specified.")
 		rootCmd.Println(rootCmd.UsageString())
-		os.Exit(1)
+		os.Exit(exitError)
 	}
-	if !viper.IsSet("apikey") {
+	if settings.authString() == "" {
 		fmt.Fprintln(os.Stderr, "Error: Grafana APIKey not specified.")
 		rootCmd.Println(rootCmd.UsageString())
-		os.Exit(1)
+		os.Exit(exitError)
+	}
+}
+
+// getGrafanaSettings resolves the settings used to connect to grafana.
+// They come from the selected context, if any, or from the top level of the
+// config file. The url and apikey flags and environment variables always win.
+func getGrafanaSettings() (grafanaContext, error) {
+	var (
+		settings grafanaContext
+		err      error
+	)
+	if name := currentContextName(); name != "" {
+		if settings, err = getContext(name); err != nil {
+			return settings, err
+		}
+		if isOverridden("url") {
+			settings.URL = viper.GetString("url")
+		}
+		if isOverridden("apikey") {
+			settings.APIKey = viper.GetString("apikey")
+			settings.Username, settings.Password = "", ""
+		}
+		if isOverridden("org-id") || isOverridden("org-name") {
+			settings.OrgID = viper.GetInt64("org-id")
+			settings.OrgName = viper.GetString("org-name")
+		}
+	} else {
+		settings.URL = viper.GetString("url")
+		settings.APIKey = viper.GetString("apikey")
+		settings.OrgID = viper.GetInt64("org-id")
+		settings.OrgName = viper.GetString("org-name")
 	}
+	if settings.OrgID != 0 && settings.OrgName != "" {
+		return settings, fmt.Errorf("only one of org-id and org-name can be specified")
+	}
+	return settings, nil
+}
+
+// isOverridden checks if a global setting was given as a flag or environment variable
+func isOverridden(key string) bool {
+	if rootCmd.PersistentFlags().Changed(key) {
+		return true
+	}
+	_, ok := os.LookupEnv("GRAFANA_" + strings.ToUpper(strings.Replace(key, "-", "_", -1)))
+	return ok
 }
 
+// getGrafanaClient creates a client for the selected context
+// Will exit if the client can't be created
 func getGrafanaClient() *client.Client {
-	return client.NewClient(viper.GetString("url"), viper.GetString("apikey"), client.DefaultHTTPClient)
+	settings, err := getGrafanaSettings()
+	if err == nil {
+		var c *client.Client
+		if c, err = newGrafanaClient(settings); err == nil {
+			return c
+		}
+	}
+	// the organization of --org-name is looked up in grafana
+	exitWithError(err)
+	return nil
+}
+
+// getGrafanaClientForContext creates a client for one of the named contexts
+// defined under the `contexts` key of the config file
+func getGrafanaClientForContext(name string) (*client.Client, error) {
+	settings, err := getContext(name)
+	if err != nil {
+		return nil, err
+	}
+	if settings.URL == "" {
+		return nil, fmt.Errorf("context '%s' does not specify a Grafana URL", name)
+	}
+	if settings.authString() == "" {
+		return nil, fmt.Errorf("context '%s' does not specify a Grafana APIKey", name)
+	}
+	return newGrafanaClient(settings)
+}
+
+// newGrafanaClient creates a client from resolved settings
+func newGrafanaClient(settings grafanaContext) (*client.Client, error) {
+	httpClient, err := newHTTPClient(settings)
+	if err != nil {
+		return nil, err
+	}
+	c := client.NewClient(settings.URL, settings.authString(), httpClient)
+	c.SetOrgID(settings.OrgID)
+	c.SetRetryPolicy(client.RetryPolicy{
+		MaxAttempts:   viper.GetInt("retry-max-attempts"),
+		MinBackoff:    viper.GetDuration("retry-min-backoff"),
+		MaxBackoff:    viper.GetDuration("retry-max-backoff"),
+		RetryStatuses: client.DefaultRetryStatuses,
+		// requests which were not applied, rejected with 429, are retried either way
+		RetryNonIdempotent: viper.GetBool("retry-non-idempotent"),
+	})
+	c.SetRateLimit(viper.GetFloat64("rate-limit"), viper.GetInt("rate-limit-burst"))
+	if settings.OrgName != "" {
+		org, err := findOrg(context.Background(), c, settings.OrgName)
+		if err != nil {
+			return nil, err
+		}
+		c.SetOrgID(org.ID)
+	}
+	return c, nil
+}
+
+// newHTTPClient applies the TLS settings of a context to an HTTP client
+func newHTTPClient(settings grafanaContext) (*http.Client, error) {
+	if !settings.InsecureSkipTLSVerify && settings.CACert == "" {
+		return client.DefaultHTTPClient, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: settings.InsecureSkipTLSVerify}
+	if settings.CACert != "" {
+		pem, err := ioutil.ReadFile(settings.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA certificate: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", settings.CACert)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
 }
@@ -17,26 +17,54 @@ package cmd
 
 import (
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 
-	"github.com/olekukonko/tablewriter"
 	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/platform9/grafanactl/pkg/printer"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-func prepareTable(searchResults []client.GrafanaSearchHit) *tablewriter.Table {
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Id", "Title", "Tags", "isStarred"})
-	for _, hit := range searchResults {
-		id := strconv.FormatUint(uint64(hit.ID), 10)
-		isStarred := strconv.FormatBool(hit.IsStarred)
-		tags := strings.Join(hit.Tags, ", ")
-		table.Append([]string{id, hit.Title, tags, isStarred})
+// searchHitList prints the results of a dashboard or folder search
+type searchHitList []client.GrafanaSearchHit
+
+func (l searchHitList) Columns() []printer.Column {
+	return []printer.Column{
+		{Header: "Id"},
+		{Header: "Title"},
+		{Header: "Tags"},
+		{Header: "isStarred"},
+		{Header: "UID", Wide: true},
+		{Header: "URL", Wide: true},
+		{Header: "Folder", Wide: true},
+		{Header: "Type", Wide: true},
 	}
-	return table
+}
+
+func (l searchHitList) Len() int {
+	return len(l)
+}
+
+func (l searchHitList) Row(i int) []string {
+	hit := l[i]
+	id := strconv.FormatUint(uint64(hit.ID), 10)
+	isStarred := strconv.FormatBool(hit.IsStarred)
+	tags := strings.Join(hit.Tags, ", ")
+	folder := hit.FolderTitle
+	// dashboards in the "General" folder have no folder title
+	if hit.Type == "dash-db" && hit.FolderID == 0 {
+		folder = "General"
+	}
+	return []string{id, hit.Title, tags, isStarred, hit.UID, hit.URL, folder, hit.Type}
+}
+
+func (l searchHitList) Name(i int) string {
+	return l[i].UID
+}
+
+func (l searchHitList) Items() interface{} {
+	return []client.GrafanaSearchHit(l)
 }
 
 // merges two int slices, ensuring that no duplicate ints are in the resulting slice
@@ -44,14 +72,18 @@ func prepareTable(searchResults []client.GrafanaSearchHit) *tablewriter.Table {
 //   types without too much interface{} juggling
 func mergeIntSlices(slice1 []int, slice2 []int) []int {
 	for _, item2 := range slice2 {
+		exists := false
 		for _, item1 := range slice1 {
 			if item1 == item2 {
 				// item2 exists already, go to next item2
+				exists = true
 				break
 			}
 		}
 		// item2 doesn't exist, append to the slice
-		slice1 = append(slice1, item2)
+		if !exists {
+			slice1 = append(slice1, item2)
+		}
 	}
 	return slice1
 }
@@ -61,14 +93,18 @@ func mergeIntSlices(slice1 []int, slice2 []int) []int {
 //   types without too much interface{} juggling
 func mergeStringSlices(slice1 []string, slice2 []string) []string {
 	for _, item2 := range slice2 {
+		exists := false
 		for _, item1 := range slice1 {
 			if item1 == item2 {
 				// item2 exists already, go to next item2
+				exists = true
 				break
 			}
 		}
 		// item2 doesn't exist, append to the slice
-		slice1 = append(slice1, item2)
+		if !exists {
+			slice1 = append(slice1, item2)
+		}
 	}
 	return slice1
 }
@@ -16,9 +16,6 @@ limitations under the License.
 package cmd
 
 import (
-	"fmt"
-	"os"
-
 	"github.com/spf13/cobra"
 )
 
@@ -31,14 +28,11 @@ var searchFolderCmd = &cobra.Command{
 		requireAuthParams()
 		c := getGrafanaClient()
 		queryParams := getSearchParams(cmd, args)
-		results, _ := c.SearchFolders(queryParams)
-		if len(results) == 0 {
-			fmt.Println("No results found.")
-			os.Exit(0)
+		results, err := c.SearchFolders(queryParams)
+		if err != nil {
+			exitWithError(err)
 		}
-		table := prepareTable(results)
-		table.Render()
-		os.Exit(0)
+		printList(searchHitList(results))
 	},
 }
 
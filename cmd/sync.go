@@ -0,0 +1,215 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// syncCmd copies folders and dashboards between two configured contexts
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync dashboards and folders from one grafana instance to another",
+	Long: `Sync dashboards and folders from one grafana instance to another
+
+The source and destination are the names of contexts defined in the config file:
+
+contexts:
+  staging:
+    url: https://grafana.staging.your.domain
+    apikey: DEFINITELYNOTYOURAPIKEY
+  prod:
+    url: https://grafana.your.domain
+    apikey: DEFINITELYNOTYOURAPIKEY
+
+Nothing is written to disk, dashboards are copied directly.
+
+Datasource references are resolved with the datasources of the destination by
+name, and UIDs of the source are resolved by the name of the source datasource.
+Use --datasource-map with a YAML file of names or UIDs and their replacements
+to rewrite references to datasources which are named differently.
+
+The synced dashboard versions get a change note, set with --message or
+generated from --message-template, like 'dashboard upload'. The note only
+holds a git commit if --source-dir is set, to the repository the dashboards
+of the source are deployed from.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			src, dst *client.Client
+			err      error
+		)
+		from := viper.GetString("from")
+		to := viper.GetString("to")
+		if from == "" || to == "" {
+			fmt.Fprintln(os.Stderr, "Error: both --from and --to must be specified.")
+			os.Exit(exitError)
+		}
+		if src, err = getGrafanaClientForContext(from); err != nil {
+			exitWithError(err)
+		}
+		if dst, err = getGrafanaClientForContext(to); err != nil {
+			exitWithError(err)
+		}
+
+		ctx := commandContext()
+		mapper, err := newDataSourceMapper(ctx, dst)
+		if err != nil {
+			exitWithError(err)
+		}
+		// the source datasources are only needed to resolve UIDs, they are skipped if they can't be listed
+		mapper.sources, _ = src.GetAllDataSourcesWithContext(ctx)
+		// the source is an instance, only --source-dir tells which repository its dashboards come from
+		message, err := saveMessage("sync", from, viper.GetString("source-dir"))
+		if err != nil {
+			exitWithError(err)
+		}
+		summary := syncInstances(ctx, src, dst, mapper, viper.GetBool("overwrite"), message)
+		if ctx.Err() != nil {
+			fmt.Fprintln(os.Stderr, "Sync interrupted.")
+			summary.failures.add(ctx.Err())
+		}
+		fmt.Println(summary)
+		if summary.failures.len() > 0 {
+			os.Exit(summary.failures.exitCode())
+		}
+	},
+}
+
+// syncSummary counts the results of syncing each folder and dashboard.
+// The failures are printed as they happen, and only kept for the exit code.
+type syncSummary struct {
+	folders    map[client.Action]int
+	dashboards map[client.Action]int
+	failures   failureReport
+}
+
+func (s syncSummary) String() string {
+	return fmt.Sprintf("Folders: %d created, %d updated, %d unchanged. Dashboards: %d created, %d updated, %d unchanged. %d failed.",
+		s.folders[client.ActionCreated], s.folders[client.ActionUpdated], s.folders[client.ActionUnchanged],
+		s.dashboards[client.ActionCreated], s.dashboards[client.ActionUpdated], s.dashboards[client.ActionUnchanged],
+		s.failures.len())
+}
+
+// syncInstances copies all folders, then all dashboards, from src to dst.
+// The datasource references of the dashboards are rewritten by mapper,
+// and the dashboards are saved with message as their change note.
+func syncInstances(ctx context.Context, src, dst *client.Client, mapper *dataSourceMapper, overwrite bool, message string) syncSummary {
+	var (
+		folders []client.GrafanaFolder
+		results []client.GrafanaSearchHit
+		err     error
+	)
+	summary := syncSummary{
+		folders:    map[client.Action]int{},
+		dashboards: map[client.Action]int{},
+	}
+
+	// Folder IDs differ between instances, map the source IDs to the destination IDs.
+	// The "General" folder always has ID of 0.
+	folderIDs := map[int64]int64{0: 0}
+	if folders, err = src.GetAllFoldersWithContext(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "error downloading folders: %s\n", err)
+		summary.failures.add(err)
+		return summary
+	}
+	for _, fol := range folders {
+		if ctx.Err() != nil {
+			return summary
+		}
+		// each instance counts the versions of its folders, the version of the source
+		// means nothing to the destination. Rename the folder of the destination at its own version.
+		fol.Version = 0
+		if existing, err := dst.GetFolderWithContext(ctx, fol.UID); err == nil {
+			fol.Version = existing.Version
+		}
+		saved, action, err := dst.SaveFolderWithContext(ctx, fol, overwrite)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "folder %s (%s): failed: %s\n", fol.Title, fol.UID, err)
+			summary.failures.add(err)
+			continue
+		}
+		folderIDs[fol.ID] = saved.ID
+		summary.folders[action]++
+		fmt.Printf("folder %s (%s): %s\n", fol.Title, fol.UID, action)
+	}
+
+	if results, err = src.SearchAllDashboardsWithContext(ctx, url.Values{}); err != nil {
+		fmt.Fprintf(os.Stderr, "error searching dashboards: %s\n", err)
+		summary.failures.add(err)
+		return summary
+	}
+	for _, board := range results {
+		if ctx.Err() != nil {
+			return summary
+		}
+		dash, err := src.GetDashboardWithContext(ctx, board.UID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dashboard %s (%s): failed: %s\n", board.Title, board.UID, err)
+			summary.failures.add(err)
+			continue
+		}
+		folderID, ok := folderIDs[dash.Meta.FolderId]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "dashboard %s (%s): failed: folder '%s' was not synced\n", board.Title, board.UID, dash.Meta.FolderTitle)
+			summary.failures.addf("folder '%s' was not synced", dash.Meta.FolderTitle)
+			continue
+		}
+		if model, err := dash.Dashboard.Map(); err == nil {
+			for _, unresolved := range mapper.rewrite(model) {
+				fmt.Fprintf(os.Stderr, "dashboard %s (%s): warning: %s\n", board.Title, board.UID, unresolved)
+			}
+		}
+		// like folders, the versions of the source mean nothing to the destination.
+		// Save the dashboard at the version of the destination.
+		dash.Dashboard.Del("version")
+		if existing, err := dst.GetDashboardWithContext(ctx, board.UID); err == nil {
+			dash.Dashboard.Set("version", existing.Meta.Version)
+		}
+		rawBoard, _ := dash.Dashboard.Encode()
+		result, err := dst.SaveDashboardWithContext(ctx, rawBoard, client.SaveDashboardOptions{
+			FolderID:  int(folderID),
+			Overwrite: overwrite,
+			Message:   message,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dashboard %s (%s): failed: %s\n", board.Title, board.UID, err)
+			summary.failures.add(err)
+			continue
+		}
+		summary.dashboards[result.Action]++
+		fmt.Printf("dashboard %s (%s): %s\n", result.Title, result.UID, result.Action)
+	}
+	return summary
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().String("from", "", "Name of the context to copy dashboards from")
+	syncCmd.Flags().String("to", "", "Name of the context to copy dashboards to")
+	syncCmd.Flags().Bool("overwrite", false, "Overwrite existing dashboards and folders in the destination.")
+	syncCmd.Flags().StringP("message", "m", "", "Change note of the saved dashboard versions (default: generated from --message-template)")
+	syncCmd.Flags().String("message-template", defaultMessageTemplate, "Template of the change note of the saved dashboard versions")
+	syncCmd.Flags().String("source-dir", "", "Git repository the dashboards of the source come from, its commit is included in the change note")
+	syncCmd.Flags().String("datasource-map", "", "YAML file of datasource names or UIDs, and the names or UIDs to replace them with")
+	viper.BindPFlags(syncCmd.Flags())
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/platform9/grafanactl/pkg/client"
+)
+
+// versionedGrafana serves the dashboards of the General folder, and rejects saving
+// a dashboard that was changed since the version that is sent, like grafana
+type versionedGrafana struct {
+	mu         sync.Mutex
+	dashboards map[string]map[string]interface{}
+}
+
+func (g *versionedGrafana) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case r.URL.Path == "/api/folders":
+		w.Write([]byte("[]"))
+	case r.URL.Path == "/api/search":
+		hits := []client.GrafanaSearchHit{}
+		if r.URL.Query().Get("page") == "1" {
+			for uid, dash := range g.dashboards {
+				hits = append(hits, client.GrafanaSearchHit{UID: uid, Title: dash["title"].(string), Type: "dash-db"})
+			}
+		}
+		json.NewEncoder(w).Encode(hits)
+	case strings.HasPrefix(r.URL.Path, "/api/dashboards/uid/"):
+		dash, ok := g.dashboards[strings.TrimPrefix(r.URL.Path, "/api/dashboards/uid/")]
+		if !ok {
+			http.Error(w, `{"message": "Dashboard not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"dashboard": dash,
+			"meta":      map[string]interface{}{"version": dash["version"], "folderId": 0},
+		})
+	case r.URL.Path == "/api/dashboards/db":
+		var req client.DashboardUploadRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		uid := req.Dashboard["uid"].(string)
+		version := 1
+		if old, ok := g.dashboards[uid]; ok {
+			sent, _ := req.Dashboard["version"].(float64)
+			if !req.Overwrite && int(sent) != old["version"].(int) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				w.Write([]byte(`{"message": "The dashboard has been changed by someone else", "status": "version-mismatch"}`))
+				return
+			}
+			version = old["version"].(int) + 1
+		}
+		req.Dashboard["version"] = version
+		g.dashboards[uid] = req.Dashboard
+		json.NewEncoder(w).Encode(map[string]interface{}{"uid": uid, "status": "success", "version": version})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (g *versionedGrafana) client() (*client.Client, *httptest.Server) {
+	srv := httptest.NewServer(g)
+	return client.NewClient(srv.URL, "key", srv.Client()), srv
+}
+
+func TestSyncChangedDashboard(t *testing.T) {
+	// the source has more versions than the destination will get
+	source := &versionedGrafana{dashboards: map[string]map[string]interface{}{
+		"d1": {"uid": "d1", "title": "First", "version": 7, "panels": []interface{}{}},
+	}}
+	destination := &versionedGrafana{dashboards: map[string]map[string]interface{}{}}
+	src, srcServer := source.client()
+	defer srcServer.Close()
+	dst, dstServer := destination.client()
+	defer dstServer.Close()
+	mapper := &dataSourceMapper{mapping: map[string]string{}}
+
+	syncOnce := func(want client.Action) {
+		t.Helper()
+		summary := syncInstances(context.Background(), src, dst, mapper, false, "synced")
+		if summary.failures.len() > 0 || summary.dashboards[want] != 1 {
+			t.Fatalf("got %s, want the dashboard to be %s", summary, want)
+		}
+	}
+	syncOnce(client.ActionCreated)
+
+	source.dashboards["d1"]["title"] = "Second"
+	source.dashboards["d1"]["version"] = 8
+	syncOnce(client.ActionUpdated)
+	syncOnce(client.ActionUnchanged)
+
+	source.dashboards["d1"]["title"] = "Third"
+	source.dashboards["d1"]["version"] = 9
+	syncOnce(client.ActionUpdated)
+	if got := destination.dashboards["d1"]; got["title"] != "Third" || got["version"] != 3 {
+		t.Errorf("got %v at version %v in the destination, want Third at version 3", got["title"], got["version"])
+	}
+}
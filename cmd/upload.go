@@ -16,7 +16,9 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -24,6 +26,7 @@ import (
 	"strings"
 
 	"github.com/platform9/grafanactl/pkg/client"
+	"github.com/platform9/grafanactl/pkg/dashboard"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -33,113 +36,601 @@ var uploadCmd = &cobra.Command{
 	Short: "Upload Grafana Dashboards",
 	Long: `Upload Grafana Dashboards
 
-Only files with a '.json' extension will be uploaded.`,
+Only files with a '.json', '.yaml', '.yml' or '.jsonnet' extension will be uploaded.
+Directories signed with a .folder.json file are folders, a directory inside of
+another is a folder nested in it. Parents are created before their children.
+A YAML file can bundle several dashboards as documents separated by '---'.
+The first document may be a folder, with a uid and a title like a .folder.json
+file, the dashboards of a bundle at the top of the directory are uploaded to it.
+
+Jsonnet files are evaluated before they are uploaded, with the library paths
+of --jpath and the external variables of --ext-str. A Jsonnet file can evaluate
+to a dashboard, a list of dashboards, or an object of dashboards by name like
+the grafanaDashboards of a monitoring mixin. '.libsonnet' files are libraries,
+they are only uploaded when given as the file to upload.
+
+Placeholders like {{values.cluster}} in the strings of dashboards are replaced
+with the values of the --values files and --set flags, looked up by their dot
+separated path. A string that is only a placeholder takes the type of the value,
+e.g. a number for alert thresholds. The upload fails if a value is not defined.
+
+Dashboards exported for sharing externally, with __inputs, are imported with
+the values of --inputs. Datasource inputs without a value use the datasource
+the dashboard was exported with, if it exists.
+
+Before anything is written, every dashboard is compared with the target instance
+and sorted into create, update, unchanged or conflict. The plan, including a diff
+of every update, is printed and must be confirmed before it is applied.
+
+A dashboard is in conflict when it was changed in grafana since the file was
+downloaded. Conflicts are only uploaded with --overwrite.
+
+Every saved dashboard version gets a change note, shown in the history of the
+dashboard. It is set with --message, or generated from --message-template, a go
+template with the fields .Command, .Source, .GitSHA, .Hostname and .User. The
+template can also be set as message-template in the config file.
+
+The datasource references of panels, queries, templating variables and
+annotations are resolved with the datasources of grafana, by name or UID.
+Use --datasource-map with a YAML file of names or UIDs and their replacements
+to rewrite references to datasources which are named differently. References
+that can't be resolved are listed in the plan.
+
+With --prune, dashboards and folders in grafana which have no local file or
+.folder.json are deleted, after the upload. Provisioned dashboards are never
+deleted, and --protect-tag and --protect-folder keep others from deletion.
+Nothing is pruned if any file or directory could not be read, as the dashboards
+in it would be deleted.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		requireAuthParams()
 
-		// Check the requested file/dir exists
-		targetFiles, err := os.Lstat(viper.GetString("files"))
+		opts, err := jsonnetOptionsFromFlags(cmd)
+		if err != nil {
+			exitWithError(err)
+		}
+		folders, skipped, err := readLocalTree(viper.GetString("files"), opts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, fmt.Sprintf("Error: %s\n", err))
-			os.Exit(1)
-		}
-		var (
-			files   []os.FileInfo
-			readErr error
-		)
-		// Check if file is a Dir or a File
-		switch mode := targetFiles.Mode(); {
-		case mode.IsDir():
-			// Enumerate a list of files in the directory
-			files, readErr = ioutil.ReadDir(targetFiles.Name())
-			if readErr != nil {
-				fmt.Fprintf(os.Stderr, fmt.Sprintf("Error: %s\n", readErr))
-				os.Exit(1)
-			}
-		case mode.IsRegular():
-			// Enumerate a list of files with just this file
-			files = []os.FileInfo{targetFiles}
+			exitWithError(err)
+		}
+		for _, err := range skipped {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		}
+		// the remote copies of files that could not be read would be deleted
+		if len(skipped) > 0 && viper.GetBool("prune") {
+			fmt.Fprintf(os.Stderr, "Error: %d files or directories could not be read, refusing to --prune.\n", len(skipped))
+			os.Exit(exitError)
+		}
+		values, err := readValues(cmd)
+		if err == nil {
+			err = renderLocalTree(folders, values)
+		}
+		if err != nil {
+			exitWithError(err)
 		}
 
+		ctx := commandContext()
 		c := getGrafanaClient()
+		overwrite := viper.GetBool("overwrite")
 
-		for _, file := range files {
-			if file.Mode().IsDir() {
-				// Check if the folder has a signature
-				var (
-					dashboardDir   string
-					folderJSONPath string
-					folderJSONRaw  []byte
-					folderJSON     client.GrafanaFolder
-					err            error
-					folder         client.GrafanaFolder
-				)
-				dashboardDir = filepath.Join(targetFiles.Name(), file.Name())
-				folderJSONPath = filepath.Join(dashboardDir, ".folder.json")
-				if _, err = os.Lstat(folderJSONPath); err != nil {
-					fmt.Fprintf(os.Stderr, fmt.Sprintf("Couldn't find .folder.json found for directory %s: %s\n", file.Name(), err))
-					continue
-				}
-				if folderJSONRaw, err = ioutil.ReadFile(folderJSONPath); err != nil {
-					fmt.Fprintf(os.Stderr, fmt.Sprintf("Unable to read file: %s\nError: %s", folderJSONPath, err))
-					continue
-				}
-				if err = json.Unmarshal(folderJSONRaw, &folderJSON); err != nil {
-					fmt.Fprintf(os.Stderr, fmt.Sprintf("Unable to unmarshal file: %v\nError: %s", folderJSONRaw, err))
-					continue
+		mapper, err := newDataSourceMapper(ctx, c)
+		if err != nil {
+			exitWithError(err)
+		}
+		inputs, err := readInputs(cmd)
+		if err != nil {
+			exitWithError(err)
+		}
+		for _, fol := range folders {
+			for i := range fol.dashboards {
+				dash := &fol.dashboards[i]
+				// the datasources of portable dashboards are resolved by their inputs instead
+				if dashboard.Inputs(dash.contents) == nil {
+					dash.unresolved = mapper.rewrite(dash.contents)
+				} else if err = resolveInputs(dash, inputs, mapper.targets); err != nil {
+					exitWithError(err)
 				}
+			}
+		}
 
-				// Use the folder as returned by create/update to get the correct ID
-				if folder, err = c.SetFolder(folderJSON, viper.GetBool("overwrite")); err != nil {
-					fmt.Fprintf(os.Stderr, fmt.Sprintf("Error setting folder '%s': %s\n", folderJSON.Title, err))
-					continue
-				}
-				if folder.ID == 0 {
-					fmt.Fprintf(os.Stderr, fmt.Sprintf("Unable to resolve the real folder ID. Skipping folder '%s'", folderJSON.Title))
-					continue
-				}
-				files, readErr = ioutil.ReadDir(filepath.Join(targetFiles.Name(), file.Name()))
-				if readErr != nil {
-					fmt.Fprintf(os.Stderr, fmt.Sprintf("Error: %s\n", readErr))
-				}
-				uploadFiles(files, dashboardDir, int(folder.ID), viper.GetBool("overwrite"))
-				continue
+		parallel := getParallel()
+
+		plan, err := buildUploadPlan(ctx, c, folders, overwrite, parallel, normalizeOptions())
+		if err == nil && viper.GetBool("prune") {
+			if info, _ := os.Stat(viper.GetString("files")); info == nil || !info.IsDir() {
+				fmt.Fprintln(os.Stderr, "Error: --prune can only be used when uploading a directory.")
+				os.Exit(exitError)
 			}
-			uploadFiles([]os.FileInfo{file}, targetFiles.Name(), 0, viper.GetBool("overwrite"))
+			plan.prune, err = buildPrunePlan(ctx, c, plan, getPruneRules(cmd))
+		}
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to plan the upload: %w", err))
+		}
+		plan.print()
+		if !plan.hasChanges() {
+			fmt.Println("No changes. Grafana is up to date.")
+			return
+		}
+		if viper.GetBool("dry-run") {
+			return
+		}
+		if !viper.GetBool("auto-approve") && !confirm("Do you want to upload these changes?") {
+			fmt.Println("Upload cancelled.")
+			os.Exit(exitError)
+		}
+		message, err := saveMessage("upload", viper.GetString("files"), viper.GetString("files"))
+		if err != nil {
+			exitWithError(err)
+		}
+		var failures failureReport
+		uploaded := applyUploadPlan(ctx, c, plan, overwrite, parallel, message, &failures)
+		deleted := applyPrune(ctx, c, plan.prune, &failures)
+		failures.print(os.Stderr)
+		if ctx.Err() != nil {
+			fmt.Fprintf(os.Stderr, "Upload interrupted after %d folders or dashboards were uploaded, and %d were deleted.\n", uploaded, deleted)
+			os.Exit(exitError)
+		}
+		if failures.len() > 0 {
+			fmt.Fprintf(os.Stderr, "%d folders or dashboards were not uploaded or deleted.\n", failures.len())
+			os.Exit(failures.exitCode())
 		}
 	},
 }
 
-func uploadFiles(files []os.FileInfo, basePath string, targetFolderID int, overwrite bool) error {
-	c := getGrafanaClient()
+// getPruneRules reads the protected tags and folders from the flags and config
+func getPruneRules(cmd *cobra.Command) pruneRules {
+	// Note: viper.GetStringSlice() does not seem to properly bind the flag
+	// as a workaround, we will merge the lists ourselves
+	tagsCobra, _ := cmd.Flags().GetStringSlice("protect-tag")
+	foldersCobra, _ := cmd.Flags().GetStringSlice("protect-folder")
+	return pruneRules{
+		protectedTags:    mergeStringSlices(viper.GetStringSlice("protect-tag"), tagsCobra),
+		protectedFolders: mergeStringSlices(viper.GetStringSlice("protect-folder"), foldersCobra),
+	}
+}
+
+// localFolder is a directory of dashboard files.
+// Directories are signed with a .folder.json file, except for the General folder.
+type localFolder struct {
+	path       string
+	folder     *client.GrafanaFolder
+	dashboards []localDashboard
+	// permissions are read from .permissions.json, nil leaves the permissions in grafana as they are
+	permissions []permission
+}
+
+func (f *localFolder) String() string {
+	if f.folder == nil {
+		return "General"
+	}
+	return fmt.Sprintf("%s (%s)", f.folder.Title, f.folder.UID)
+}
+
+// localDashboard is a dashboard file read from disk
+type localDashboard struct {
+	path     string
+	contents map[string]interface{}
+	// unresolved are the datasource references that don't exist in grafana
+	unresolved []dashboard.UnresolvedDataSource
+	// portable is the dashboard as it was exported for sharing externally, it is imported with inputs.
+	// contents then holds the dashboard as grafana imports it.
+	portable map[string]interface{}
+	inputs   []client.DashboardImportInput
+}
+
+func (d localDashboard) title() string {
+	return fmt.Sprintf("%v", d.contents["title"])
+}
+
+func (d localDashboard) uid() string {
+	uid, _ := d.contents["uid"].(string)
+	return uid
+}
+
+func (d localDashboard) version() int {
+	version, _ := d.contents["version"].(float64)
+	return int(version)
+}
+
+func (d localDashboard) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.path, d.title(), d.uid())
+}
+
+// readLocalTree reads the dashboards in a file or directory.
+// The dashboards at the top of a directory belong to the General folder,
+// and each signed subdirectory is a grafana folder, nested in the folder of
+// the directory it is in. Parents are returned before their children.
+// A YAML bundle at the top of a directory is a grafana folder of its own.
+// Files and directories that could not be read are left out, and returned as skipped.
+// An invalid .permissions.json file is an error, the folder can't be uploaded without it.
+func readLocalTree(root string, opts jsonnetOptions) (folders []*localFolder, skipped []error, err error) {
+	targetFiles, err := os.Stat(root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// A single file belongs to the folder of the directory it is in, if that is signed,
+	// or to the folder of the bundle
+	if targetFiles.Mode().IsRegular() {
+		fol := &localFolder{path: filepath.Dir(root)}
+		if signature, err := readFolderSignature(fol.path); err == nil {
+			fol.folder = &signature
+		}
+		dashboards, bundle, err := readDashboardFile(root, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if bundle != nil {
+			fol = &localFolder{path: root, folder: bundle}
+		}
+		fol.dashboards = append(fol.dashboards, dashboards...)
+		return []*localFolder{fol}, nil, nil
+	}
+
+	// Enumerate a list of files in the directory
+	files, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	general := &localFolder{path: root}
+	folders = []*localFolder{general}
 	for _, file := range files {
-		if file.Mode().IsDir() {
-			return fmt.Errorf("uploadFiles will not upload directories")
+		path := filepath.Join(root, file.Name())
+		if isJsonnetLibrary(path) {
+			continue
+		}
+		if !file.IsDir() {
+			dashboards, bundle, err := readDashboardFile(path, opts)
+			if err != nil {
+				skipped = append(skipped, err)
+				continue
+			}
+			if bundle != nil {
+				folders = append(folders, &localFolder{path: path, folder: bundle, dashboards: dashboards})
+				continue
+			}
+			general.dashboards = append(general.dashboards, dashboards...)
+			continue
 		}
 
-		var (
-			rawBoard []byte
-			err      error
-		)
+		nested, err := readFolderTree(path, nil, opts, &skipped)
+		if err != nil {
+			return nil, skipped, err
+		}
+		folders = append(folders, nested...)
+	}
+	return folders, skipped, nil
+}
 
-		dashboardFile := filepath.Join(basePath, file.Name())
-		if !strings.HasSuffix(dashboardFile, ".json") {
-			fmt.Printf("Skipping '%s' (Not a JSON file)\n", file.Name())
+// readFolderTree reads a signed directory as a grafana folder, followed by the signed
+// directories nested in it, at any depth. A folder is nested in the folder of its parent
+// directory, if it has one, or else in the parent of its .folder.json.
+// Directories without a .folder.json are not folders, they are reported and left out.
+// Files and directories that could not be read are added to skipped, an invalid
+// .permissions.json file is returned as an error.
+func readFolderTree(path string, parent *localFolder, opts jsonnetOptions, skipped *[]error) ([]*localFolder, error) {
+	signature, err := readFolderSignature(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return nil, nil
+	}
+	if err != nil {
+		*skipped = append(*skipped, err)
+		return nil, nil
+	}
+	if parent != nil {
+		signature.ParentUID = parent.folder.UID
+	}
+	signature.Parents = nil
+	fol := &localFolder{path: path, folder: &signature}
+	if fol.permissions, err = readPermissionsFile(path); err != nil {
+		return nil, err
+	}
+	dashboardFiles, err := ioutil.ReadDir(path)
+	if err != nil {
+		*skipped = append(*skipped, err)
+		return nil, nil
+	}
+	folders := []*localFolder{fol}
+	for _, dashboardFile := range dashboardFiles {
+		dashboardPath := filepath.Join(path, dashboardFile.Name())
+		if dashboardFile.IsDir() {
+			nested, err := readFolderTree(dashboardPath, fol, opts, skipped)
+			if err != nil {
+				return nil, err
+			}
+			folders = append(folders, nested...)
+			continue
+		}
+		if isJsonnetLibrary(dashboardPath) {
+			continue
+		}
+		dashboards, bundle, err := readDashboardFile(dashboardPath, opts)
+		if err != nil {
+			*skipped = append(*skipped, err)
+			continue
+		}
+		if bundle != nil && bundle.UID != signature.UID {
+			fmt.Printf("Skipping '%s' (Bundles inside of folders must be of the same folder)\n", dashboardPath)
 			continue
 		}
+		fol.dashboards = append(fol.dashboards, dashboards...)
+	}
+	return folders, nil
+}
+
+// readFolderSignature reads the .folder.json file of a directory
+func readFolderSignature(dir string) (client.GrafanaFolder, error) {
+	var (
+		folderJSONPath string
+		folderJSONRaw  []byte
+		folderJSON     client.GrafanaFolder
+		err            error
+	)
+	folderJSONPath = filepath.Join(dir, ".folder.json")
+	if _, err = os.Lstat(folderJSONPath); err != nil {
+		return folderJSON, fmt.Errorf("Couldn't find .folder.json found for directory %s: %w", dir, err)
+	}
+	if folderJSONRaw, err = ioutil.ReadFile(folderJSONPath); err != nil {
+		return folderJSON, fmt.Errorf("Unable to read file: %s\nError: %s", folderJSONPath, err)
+	}
+	if err = json.Unmarshal(folderJSONRaw, &folderJSON); err != nil {
+		return folderJSON, fmt.Errorf("Unable to unmarshal file: %s\nError: %s", folderJSONPath, err)
+	}
+	return folderJSON, nil
+}
+
+// importDashboard imports a portable dashboard of the upload plan with its inputs.
+// The import API can't save a change note, and only replaces dashboards with overwrite,
+// so updates are always overwritten, the plan has checked them for conflicts.
+func importDashboard(ctx context.Context, c *client.Client, dp dashboardPlan, folderID int, overwrite bool, uploaded *int, failures *failureReport) func() {
+	template := make(map[string]interface{}, len(dp.local.portable))
+	for key, value := range dp.local.portable {
+		template[key] = value
+	}
+	template["id"] = nil
+	result, err := c.ImportDashboardWithContext(ctx, template, dp.local.inputs, folderID, overwrite || dp.action == planUpdate)
+	return func() {
+		if err != nil {
+			if ctx.Err() == nil {
+				failures.addf("Unable to import %s: %w", dp.local.path, err)
+			}
+			return
+		}
+		action := client.ActionCreated
+		if dp.action == planUpdate {
+			action = client.ActionUpdated
+		}
+		fmt.Printf("Dashboard %s (%s) %s\n", result.Title, dp.local.uid(), action)
+		*uploaded++
+	}
+}
+
+// isJsonnetLibrary checks if a file is a Jsonnet library, these are imported by the
+// Jsonnet files of dashboards and are only evaluated on their own when uploaded directly
+func isJsonnetLibrary(path string) bool {
+	return strings.HasSuffix(path, ".libsonnet")
+}
 
-		if rawBoard, err = ioutil.ReadFile(dashboardFile); err != nil {
-			fmt.Fprintf(os.Stderr, fmt.Sprintf("Unable to read file %s: %s\n", dashboardFile, err))
+// readDashboardFile reads the dashboards of a JSON, YAML or Jsonnet file.
+// A YAML file can be a bundle of several documents, the first of which may be
+// the folder of the others, it is returned as well.
+// Files and documents that are not dashboards are reported and skipped.
+// An error is returned for files that could not be read, parsed or evaluated.
+func readDashboardFile(path string, opts jsonnetOptions) ([]localDashboard, *client.GrafanaFolder, error) {
+	if base := filepath.Base(path); base == ".folder.json" || base == permissionsFile {
+		return nil, nil, nil
+	}
+	if dashboardFileFormat(path) == "" {
+		fmt.Printf("Skipping '%s' (Not a JSON, YAML or Jsonnet file)\n", path)
+		return nil, nil, nil
+	}
+	rawBoard, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to read file %s: %s", path, err)
+	}
+	docs, err := dashboardDocuments(path, rawBoard, opts)
+	if err != nil && dashboardFileFormat(path) == formatJsonnet {
+		return nil, nil, fmt.Errorf("Unable to evaluate file %s: %s", path, err)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to unmarshal file %s: %s", path, err)
+	}
+	var (
+		dashboards []localDashboard
+		folder     *client.GrafanaFolder
+	)
+	for i, doc := range docs {
+		dash := localDashboard{path: path}
+		if err = json.Unmarshal(doc, &dash.contents); err != nil {
+			return nil, nil, fmt.Errorf("Unable to unmarshal file %s: %s", path, err)
+		}
+		// crude check for a valid dashboard
+		if dash.contents["panels"] != nil {
+			dashboards = append(dashboards, dash)
+			continue
+		}
+		if i == 0 && len(docs) > 1 {
+			folder = &client.GrafanaFolder{}
+			if err = json.Unmarshal(doc, folder); err == nil && folder.UID != "" && folder.Title != "" {
+				continue
+			}
+			return nil, nil, fmt.Errorf("Unable to read the folder of bundle %s: it must have a uid and a title", path)
+		}
+		if len(docs) > 1 {
+			fmt.Printf("Skipping document %d of '%s' (Not a dashboard)\n", i+1, path)
 			continue
 		}
+		fmt.Printf("Skipping '%s' (Not a dashboard)\n", path)
+	}
+	return dashboards, folder, nil
+}
+
+// applyUploadPlan creates and updates the folders and dashboards in the plan,
+// with up to parallel requests at once.
+// Folders are saved first, so that the dashboards can be placed in them.
+// Dashboards are saved with message as their change note.
+// Errors are added to the failure report.
+// Returns the number of folders and dashboards that were uploaded.
+func applyUploadPlan(ctx context.Context, c *client.Client, plan uploadPlan, overwrite bool, parallel int, message string, failures *failureReport) int {
+	uploaded := 0
+	// The "General" folder always has ID of 0
+	folderIDs := map[*localFolder]int{}
+	// parents are saved before their children, the folders of one level at once
+	parents := localParents(plan.folders)
+	for _, level := range folderLevels(plan.folders, parents) {
+		applyFolderPlans(ctx, c, level, parents, overwrite, parallel, folderIDs, &uploaded, failures)
+	}
+
+	// every folder is done before the first dashboard is uploaded
+	runParallel(ctx, parallel, len(plan.dashboards), func(i int) func() {
+		dp := plan.dashboards[i]
+		switch dp.action {
+		case planUnchanged:
+			return nil
+		case planConflict:
+			return func() {
+				failures.addf("Skipping %s (conflict)", dp.local.path)
+			}
+		}
+		// folderIDs is only written by the folders above, it is safe to read here
+		folderID, ok := folderIDs[dp.folder]
+		if !ok {
+			return func() {
+				failures.addf("Skipping %s (folder %s was not uploaded)", dp.local.path, dp.folder)
+			}
+		}
+		if dp.local.portable != nil {
+			return importDashboard(ctx, c, dp, folderID, overwrite, &uploaded, failures)
+		}
+		if dp.local.version() == 0 && dp.remoteVersion != 0 {
+			dp.local.contents["version"] = dp.remoteVersion
+		}
+		rawBoard, _ := json.Marshal(dp.local.contents)
+		result, err := c.SaveDashboardWithContext(ctx, rawBoard, client.SaveDashboardOptions{
+			FolderID:  folderID,
+			Overwrite: overwrite,
+			Message:   message,
+		})
+		return func() {
+			if err != nil {
+				if ctx.Err() == nil {
+					failures.addf("Unable to upload %s: %w", dp.local.path, err)
+				}
+				return
+			}
+			fmt.Printf("Dashboard %s (%s) %s\n", result.Title, result.UID, result.Action)
+			uploaded++
+		}
+	})
+	return uploaded
+}
+
+// applyFolderPlans creates and updates folders, with up to parallel requests at once.
+// The ID of every saved folder is added to folderIDs, a folder whose local parent
+// is not in it is skipped.
+func applyFolderPlans(ctx context.Context, c *client.Client, folders []folderPlan, parents map[*localFolder]*localFolder, overwrite bool, parallel int, folderIDs map[*localFolder]int, uploaded *int, failures *failureReport) {
+	// the parents are checked before the level is saved, folderIDs is written while it is
+	unsavedParents := map[*localFolder]*localFolder{}
+	for _, fp := range folders {
+		if parent, ok := parents[fp.local]; ok {
+			if _, saved := folderIDs[parent]; !saved {
+				unsavedParents[fp.local] = parent
+			}
+		}
+	}
+	runParallel(ctx, parallel, len(folders), func(i int) func() {
+		fp := folders[i]
+		if parent, ok := unsavedParents[fp.local]; ok {
+			return func() {
+				failures.addf("Skipping folder %s (parent folder %s was not uploaded)", fp.local, parent)
+			}
+		}
+		if fp.local.folder == nil {
+			return func() {
+				folderIDs[fp.local] = 0
+			}
+		}
+		// Use the folder as returned by create/update to get the correct ID
+		folder, action, err := c.SaveFolderWithContext(ctx, *fp.local.folder, overwrite)
+		var permErr error
+		if err == nil && folder.ID != 0 && fp.permissionsChanged {
+			permErr = c.UpdateFolderPermissionsWithContext(ctx, fp.local.folder.UID, fp.permissions)
+		}
+		return func() {
+			if err != nil {
+				if ctx.Err() == nil {
+					failures.addf("Error setting folder '%s': %w", fp.local.folder.Title, err)
+				}
+				return
+			}
+			if folder.ID == 0 {
+				failures.addf("Unable to resolve the real folder ID. Skipping folder '%s'", fp.local.folder.Title)
+				return
+			}
+			if action != client.ActionUnchanged {
+				fmt.Printf("Folder %s %s\n", fp.local, action)
+				*uploaded++
+			}
+			folderIDs[fp.local] = int(folder.ID)
+			if !fp.permissionsChanged {
+				return
+			}
+			if permErr != nil {
+				if ctx.Err() == nil {
+					failures.addf("Error setting the permissions of folder '%s': %w", fp.local.folder.Title, permErr)
+				}
+				return
+			}
+			fmt.Printf("Folder %s permissions updated\n", fp.local)
+			if action == client.ActionUnchanged {
+				*uploaded++
+			}
+		}
+	})
+}
 
-		// Replace the dashboard
-		if err = c.SetDashboard(rawBoard, overwrite, targetFolderID); err != nil {
-			fmt.Fprintf(os.Stderr, fmt.Sprintf("Unable to upload %s: %s\n", dashboardFile, err))
+// localParents maps the local folders that are nested in another local folder to their parent
+func localParents(folders []folderPlan) map[*localFolder]*localFolder {
+	byUID := map[string]*localFolder{}
+	for _, fp := range folders {
+		if fp.local.folder != nil {
+			byUID[fp.local.folder.UID] = fp.local
+		}
+	}
+	parents := map[*localFolder]*localFolder{}
+	for _, fp := range folders {
+		if fp.local.folder == nil {
 			continue
 		}
+		if parent, ok := byUID[fp.local.folder.ParentUID]; ok {
+			parents[fp.local] = parent
+		}
+	}
+	return parents
+}
+
+// folderLevels groups folders by their depth in the local tree, from the top level down,
+// keeping their order. Folders nested in a folder that is not local are at the top level.
+func folderLevels(folders []folderPlan, parents map[*localFolder]*localFolder) [][]folderPlan {
+	var levels [][]folderPlan
+	for _, fp := range folders {
+		depth := 0
+		// folders in a cycle of parents end up on the last level, and are skipped as their parent is never saved
+		for parent := parents[fp.local]; parent != nil && depth < len(folders); parent = parents[parent] {
+			depth++
+		}
+		for len(levels) <= depth {
+			levels = append(levels, nil)
+		}
+		levels[depth] = append(levels[depth], fp)
+	}
+	nonEmpty := levels[:0]
+	for _, level := range levels {
+		if len(level) > 0 {
+			nonEmpty = append(nonEmpty, level)
+		}
 	}
-	return nil
+	return nonEmpty
 }
 
 func init() {
@@ -148,5 +639,18 @@ func init() {
 	uploadCmd.Flags().StringP(
 		"files", "f", ".", "Target file or directory of dashboard files to upload.")
 	uploadCmd.Flags().Bool("overwrite", false, "Overwrite existing dashboard with newer version, same dashboard title in folder, or same dashboard UID.")
+	uploadCmd.Flags().String("datasource-map", "", "YAML file of datasource names or UIDs, and the names or UIDs to replace them with")
+	uploadCmd.Flags().StringP("message", "m", "", "Change note of the saved dashboard versions (default: generated from --message-template)")
+	uploadCmd.Flags().String("message-template", defaultMessageTemplate, "Template of the change note of the saved dashboard versions")
+	uploadCmd.Flags().Bool("dry-run", false, "Only print the planned changes, don't upload anything.")
+	uploadCmd.Flags().Int("parallel", 1, "Number of dashboards to compare and upload at once")
+	uploadCmd.Flags().Bool("auto-approve", false, "Upload the planned changes without asking for confirmation.")
+	uploadCmd.Flags().Bool("prune", false, "Delete dashboards and folders in grafana that don't exist locally.")
+	uploadCmd.Flags().StringSlice("protect-tag", []string{}, "Never prune dashboards with these tags.")
+	uploadCmd.Flags().StringSlice("protect-folder", []string{}, "Never prune these folders (UID or title), or the dashboards in them.")
+	addJsonnetFlags(uploadCmd)
+	addNormalizeFlags(uploadCmd)
+	addValuesFlags(uploadCmd)
+	uploadCmd.Flags().StringArray("inputs", []string{}, "Value of an input of portable dashboards as name=value, e.g. DS_PROMETHEUS=Prometheus")
 	viper.BindPFlags(uploadCmd.Flags())
 }
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/platform9/grafanactl/pkg/client"
+)
+
+// writeTree writes files, by their path relative to a temporary directory, and returns the directory.
+// The caller removes the directory.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root, err := ioutil.TempDir("", "grafanactl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// localUIDs returns the UIDs of the dashboards that were read
+func localUIDs(folders []*localFolder) []string {
+	var uids []string
+	for _, fol := range folders {
+		for _, dash := range fol.dashboards {
+			uids = append(uids, dash.uid())
+		}
+	}
+	return uids
+}
+
+func TestReadLocalTreeSkipped(t *testing.T) {
+	const dash = `{"uid": "ok", "title": "OK", "panels": []}`
+	tests := []struct {
+		name  string
+		files map[string]string
+		// skipped is part of the message of the file or directory that is skipped
+		skipped string
+	}{
+		{name: "invalid JSON", files: map[string]string{"broken.json": `{"uid": "broken",`}, skipped: "broken.json"},
+		{name: "invalid YAML", files: map[string]string{"broken.yaml": "uid: [broken"}, skipped: "broken.yaml"},
+		{name: "failed Jsonnet", files: map[string]string{"broken.jsonnet": `{ uid: error "failed" }`}, skipped: "broken.jsonnet"},
+		{name: "bundle without a folder", files: map[string]string{"bundle.yaml": "title: no uid\n---\n" + dash}, skipped: "bundle.yaml"},
+		{name: "invalid .folder.json", files: map[string]string{
+			"team/.folder.json": `{"uid": `,
+			"team/dash.json":    `{"uid": "lost", "title": "Lost", "panels": []}`,
+		}, skipped: ".folder.json"},
+		{name: "invalid nested file", files: map[string]string{
+			"team/.folder.json":         `{"uid": "team", "title": "Team"}`,
+			"team/child/.folder.json":   `{"uid": "child", "title": "Child"}`,
+			"team/child/broken.json":    `not json`,
+			"team/child/dashboard.json": `{"uid": "nested", "title": "Nested", "panels": []}`,
+		}, skipped: "broken.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.files["ok.json"] = dash
+			root := writeTree(t, tt.files)
+			defer os.RemoveAll(root)
+			folders, skipped, err := readLocalTree(root, jsonnetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(skipped) != 1 || !strings.Contains(skipped[0].Error(), tt.skipped) {
+				t.Fatalf("skipped %v, want one error about %s", skipped, tt.skipped)
+			}
+			if uids := localUIDs(folders); len(uids) == 0 || uids[0] != "ok" {
+				t.Errorf("read dashboards %v, want the valid dashboard to be read", uids)
+			}
+		})
+	}
+}
+
+func TestReadLocalTreeNotSkipped(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"ok.json":                 `{"uid": "ok", "title": "OK", "panels": []}`,
+		"README.md":               "not a dashboard file",
+		"settings.json":           `{"not": "a dashboard"}`,
+		"lib/grafana.libsonnet":   "{}",
+		"unsigned/dashboard.json": `{"uid": "unsigned", "title": "Unsigned", "panels": []}`,
+		"team/.folder.json":       `{"uid": "team", "title": "Team"}`,
+		"team/.permissions.json":  `[]`,
+		"team/dashboard.json":     `{"uid": "team-dash", "title": "Team", "panels": []}`,
+	})
+	defer os.RemoveAll(root)
+	folders, skipped, err := readLocalTree(root, jsonnetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 0 {
+		t.Errorf("skipped %v, want files that are not dashboards and unsigned directories to be left out silently", skipped)
+	}
+	if uids := localUIDs(folders); strings.Join(uids, ",") != "ok,team-dash" {
+		t.Errorf("read dashboards %v, want ok and team-dash", uids)
+	}
+}
+
+func TestReadLocalTreeInvalidPermissions(t *testing.T) {
+	// a folder without its permissions is not uploaded at all, and with --prune it would be deleted
+	root := writeTree(t, map[string]string{
+		"ok.json":                      `{"uid": "ok", "title": "OK", "panels": []}`,
+		"team/.folder.json":            `{"uid": "team", "title": "Team"}`,
+		"team/child/.folder.json":      `{"uid": "child", "title": "Child"}`,
+		"team/child/.permissions.json": `{"role": `,
+	})
+	defer os.RemoveAll(root)
+	_, _, err := readLocalTree(root, jsonnetOptions{})
+	if err == nil || !strings.Contains(err.Error(), ".permissions.json") {
+		t.Fatalf("got error %v, want an error about .permissions.json", err)
+	}
+}
+
+func TestFolderLevels(t *testing.T) {
+	folder := func(uid, parentUID string) folderPlan {
+		return folderPlan{local: &localFolder{path: uid, folder: &client.GrafanaFolder{UID: uid, ParentUID: parentUID}}}
+	}
+	folders := []folderPlan{
+		{local: &localFolder{path: "general"}},
+		folder("grandchild", "child"),
+		folder("child", "top"),
+		folder("top", ""),
+		// nested in a folder that only exists in grafana
+		folder("remote-child", "remote"),
+		folder("other-child", "top"),
+		// a cycle of parents
+		folder("a", "b"),
+		folder("b", "a"),
+	}
+	parents := localParents(folders)
+	if len(parents) != 5 || parents[folders[1].local] != folders[2].local || parents[folders[2].local] != folders[3].local {
+		t.Fatalf("parents %v, want every folder nested in a local folder to have its parent", parents)
+	}
+
+	var got []string
+	for _, level := range folderLevels(folders, parents) {
+		var paths []string
+		for _, fp := range level {
+			paths = append(paths, fp.local.path)
+		}
+		got = append(got, strings.Join(paths, ","))
+	}
+	// levels keep the order of the folders, folders in a cycle end up on the last level
+	want := []string{"general,top,remote-child", "child,other-child", "grandchild", "a,b"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("levels %q, want %q", got, want)
+	}
+}
+
+func TestApplyNestedFoldersInParallel(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		created []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, `{"message": "Folder not found"}`, http.StatusNotFound)
+			return
+		}
+		var fol client.GrafanaFolder
+		json.NewDecoder(r.Body).Decode(&fol)
+		mu.Lock()
+		created = append(created, fol.UID)
+		fol.ID = int64(len(created))
+		mu.Unlock()
+		json.NewEncoder(w).Encode(fol)
+	}))
+	defer srv.Close()
+	c := client.NewClient(srv.URL, "key", srv.Client())
+
+	// more folders on a level than are saved at once, so that folders are saved while others are done
+	folders := []client.GrafanaFolder{{UID: "top", Title: "Top"}, {UID: "orphan", Title: "Orphan", ParentUID: "missing"}}
+	for _, uid := range []string{"a", "b", "c", "d", "e", "f"} {
+		folders = append(folders,
+			client.GrafanaFolder{UID: uid, Title: uid, ParentUID: "top"},
+			client.GrafanaFolder{UID: uid + "1", Title: uid + "1", ParentUID: uid})
+	}
+	var plan uploadPlan
+	for i := range folders {
+		plan.folders = append(plan.folders, folderPlan{local: &localFolder{folder: &folders[i]}, action: planCreate})
+	}
+	var failures failureReport
+	if uploaded := applyUploadPlan(context.Background(), c, plan, false, 2, "", &failures); uploaded != len(folders) || failures.len() != 0 {
+		t.Fatalf("uploaded %d folders with %d failures, want %d and none", uploaded, failures.len(), len(folders))
+	}
+	position := map[string]int{}
+	for i, uid := range created {
+		position[uid] = i
+	}
+	for _, fp := range plan.folders {
+		if parent, ok := position[fp.local.folder.ParentUID]; ok && parent > position[fp.local.folder.UID] {
+			t.Errorf("folder %s was created before its parent %s", fp.local.folder.UID, fp.local.folder.ParentUID)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright © 2020 Platform9 Systems
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/platform9/grafanactl/pkg/dashboard"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// readValues reads the values of placeholders from the --values files, in order,
+// and the --set flags, which override them
+func readValues(cmd *cobra.Command) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, path := range viper.GetStringSlice("values") {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read values file %s: %w", path, err)
+		}
+		docs, err := dashboard.YAMLToJSON(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read values file %s: %w", path, err)
+		}
+		for _, doc := range docs {
+			var fileValues map[string]interface{}
+			if err = json.Unmarshal(doc, &fileValues); err != nil {
+				return nil, fmt.Errorf("values file %s must be a map of names and values", path)
+			}
+			mergeValues(values, fileValues)
+		}
+	}
+	sets, _ := cmd.Flags().GetStringArray("set")
+	for _, set := range sets {
+		parts := strings.SplitN(set, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid --set '%s', must be name=value", set)
+		}
+		// values are parsed like YAML, so that numbers and booleans keep their type
+		var value interface{} = parts[1]
+		if docs, err := dashboard.YAMLToJSON([]byte(parts[1])); err == nil && len(docs) == 1 {
+			_ = json.Unmarshal(docs[0], &value)
+		}
+		setValue(values, strings.Split(parts[0], "."), value)
+	}
+	return values, nil
+}
+
+// mergeValues merges the values of from into values, the maps of both are merged recursively
+func mergeValues(values, from map[string]interface{}) {
+	for key, value := range from {
+		existing, isMap := values[key].(map[string]interface{})
+		fromMap, fromIsMap := value.(map[string]interface{})
+		if isMap && fromIsMap {
+			mergeValues(existing, fromMap)
+			continue
+		}
+		values[key] = value
+	}
+}
+
+// setValue sets a value at a path of keys, creating the maps on the way
+func setValue(values map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := values[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			values[key] = next
+		}
+		values = next
+	}
+	values[path[len(path)-1]] = value
+}
+
+// renderLocalTree replaces the placeholders of the local dashboards with values.
+// Returns an error listing every undefined value, by the file it is used in.
+func renderLocalTree(folders []*localFolder, values map[string]interface{}) error {
+	var undefined []string
+	for _, fol := range folders {
+		for _, dash := range fol.dashboards {
+			for _, path := range dashboard.RenderValues(dash.contents, values) {
+				undefined = append(undefined, fmt.Sprintf("  %s: values.%s", dash.path, path))
+			}
+		}
+	}
+	if len(undefined) > 0 {
+		return fmt.Errorf("undefined values, set them with --values or --set:\n%s", strings.Join(undefined, "\n"))
+	}
+	return nil
+}
+
+// addValuesFlags adds the flags of readValues to a command
+func addValuesFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("values", []string{}, "YAML files with the values of {{values.name}} placeholders, later files override earlier ones")
+	cmd.Flags().StringArray("set", []string{}, "Value of a placeholder as name=value, overriding --values. Nested values are set with dots, e.g. alerts.threshold=90")
+}
@@ -4,16 +4,18 @@ go 1.13
 
 require (
 	github.com/bmizerany/assert v0.0.0-20160611221934-b7ed37b82869 // indirect
+	github.com/go-git/go-git/v5 v5.4.2
 	github.com/go-macaron/session v0.0.0-20191101041208-c5d57a35f512 // indirect
 	github.com/go-sql-driver/mysql v1.5.0 // indirect
+	github.com/google/go-jsonnet v0.17.0
 	github.com/gosimple/slug v1.9.0 // indirect
 	github.com/grafana/grafana v6.1.6+incompatible
 	github.com/inconshreveable/log15 v0.0.0-20200109203555-b30bc20e4fd1 // indirect
-	github.com/mattn/go-colorable v0.1.4 // indirect
-	github.com/mattn/go-isatty v0.0.11 // indirect
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/olekukonko/tablewriter v0.0.4
+	github.com/oliveagle/jsonpath v0.0.0-20180606110733-2e52cf6e6852
 	github.com/pelletier/go-toml v1.6.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/spf13/afero v1.2.2 // indirect
 	github.com/spf13/cast v1.3.1 // indirect
 	github.com/spf13/cobra v0.0.5
@@ -21,7 +23,6 @@ require (
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/spf13/viper v1.6.1
 	github.com/teris-io/shortid v0.0.0-20171029131806-771a37caa5cf // indirect
-	golang.org/x/sys v0.0.0-20200107162124-548cf772de50 // indirect
 	gopkg.in/ini.v1 v1.51.1 // indirect
-	gopkg.in/yaml.v2 v2.2.7 // indirect
+	gopkg.in/yaml.v2 v2.3.0
 )
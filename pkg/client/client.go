@@ -2,24 +2,39 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
 )
 
 // DefaultHTTPClient is the default HTTP client to use for API calls
 var DefaultHTTPClient = http.DefaultClient
 
+// Action describes what a Save call did to an object in grafana
+type Action string
+
+// Actions that may be taken when saving an object
+const (
+	ActionCreated   Action = "created"
+	ActionUpdated   Action = "updated"
+	ActionUnchanged Action = "unchanged"
+)
+
 // Client uses Grafana HTTP API for interacting with Grafana Server
 type Client struct {
 	baseURL   string
 	key       string
 	basicAuth bool
+	orgID     int64
 	client    *http.Client
+	retry     RetryPolicy
+	limiter   *rateLimiter
 }
 
 // NewClient initializes client for interacting with Grafana Server
@@ -42,44 +57,101 @@ func NewClient(apiURL, authString string, client *http.Client) *Client {
 	}
 }
 
-func (r *Client) get(query string, params url.Values) ([]byte, int, error) {
-	return r.doRequest("GET", query, params, nil)
+// SetOrgID makes all requests act on the organization with the given ID,
+// instead of the organization of the authenticated user. An ID of 0 unsets it.
+func (r *Client) SetOrgID(orgID int64) {
+	r.orgID = orgID
+}
+
+func (r *Client) get(ctx context.Context, query string, params url.Values) ([]byte, error) {
+	return r.doRequest(ctx, "GET", query, params, nil)
 }
 
-func (r *Client) patch(query string, params url.Values, body []byte) ([]byte, int, error) {
-	return r.doRequest("PATCH", query, params, bytes.NewBuffer(body))
+func (r *Client) patch(ctx context.Context, query string, params url.Values, body []byte) ([]byte, error) {
+	return r.doRequest(ctx, "PATCH", query, params, body)
 }
 
-func (r *Client) put(query string, params url.Values, body []byte) ([]byte, int, error) {
-	return r.doRequest("PUT", query, params, bytes.NewBuffer(body))
+func (r *Client) put(ctx context.Context, query string, params url.Values, body []byte) ([]byte, error) {
+	return r.doRequest(ctx, "PUT", query, params, body)
 }
 
-func (r *Client) post(query string, params url.Values, body []byte) ([]byte, int, error) {
-	return r.doRequest("POST", query, params, bytes.NewBuffer(body))
+func (r *Client) post(ctx context.Context, query string, params url.Values, body []byte) ([]byte, error) {
+	return r.doRequest(ctx, "POST", query, params, body)
 }
 
-func (r *Client) delete(query string) ([]byte, int, error) {
-	return r.doRequest("DELETE", query, nil, nil)
+func (r *Client) delete(ctx context.Context, query string) ([]byte, error) {
+	return r.doRequest(ctx, "DELETE", query, nil, nil)
 }
 
-func (r *Client) doRequest(method, query string, params url.Values, buf io.Reader) ([]byte, int, error) {
+// doRequest sends a request, waiting for the rate limiter first.
+// Requests which fail with a temporary error are retried according to the retry policy.
+// Responses with an error status are returned as an *APIError.
+func (r *Client) doRequest(ctx context.Context, method, query string, params url.Values, body []byte) ([]byte, error) {
 	u, _ := url.Parse(r.baseURL)
-	u.Path = path.Join(u.Path, query)
+	// query is an escaped path, the names in it may hold escaped slashes
+	unescaped, err := url.PathUnescape(query)
+	if err != nil {
+		return nil, err
+	}
+	u.RawPath = path.Join(u.EscapedPath(), query)
+	u.Path = path.Join(u.Path, unescaped)
 	if params != nil {
 		u.RawQuery = params.Encode()
 	}
-	req, err := http.NewRequest(method, u.String(), buf)
+	for attempt := 1; ; attempt++ {
+		if r.limiter != nil {
+			if err := r.limiter.wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := r.send(ctx, method, u.String(), body)
+		if err != nil && ctx.Err() != nil {
+			return nil, err
+		}
+		code := 0
+		if resp != nil {
+			code = resp.StatusCode
+		}
+		if !r.retry.shouldRetry(method, attempt, code, err) {
+			if err != nil {
+				return nil, err
+			}
+			data, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err == nil && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+				err = newAPIError(method, u.Path, resp.StatusCode, data)
+			}
+			return data, err
+		}
+		if resp != nil {
+			// drain the body so the connection can be reused
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, r.retry.backoff(attempt, resp)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send makes a single attempt at a request
+func (r *Client) send(ctx context.Context, method, u string, body []byte) (*http.Response, error) {
+	var buf io.Reader
+	if body != nil {
+		buf = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, buf)
+	if err != nil {
+		return nil, err
+	}
 	if !r.basicAuth {
 		req.Header.Set("Authorization", r.key)
 	}
+	if r.orgID != 0 {
+		req.Header.Set("X-Grafana-Org-Id", strconv.FormatInt(r.orgID, 10))
+	}
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "platform9-grafanactl")
-	resp, err := r.client.Do(req)
-	if err != nil {
-		return nil, 0, err
-	}
-	data, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
-	return data, resp.StatusCode, err
+	return r.client.Do(req)
 }
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"reflect"
@@ -13,6 +14,7 @@ type DashboardUploadRequest struct {
 	Dashboard map[string]interface{} `json:"dashboard"`
 	FolderID  int                    `json:"folderId"`
 	Overwrite bool                   `json:"overwrite"`
+	Message   string                 `json:"message,omitempty"`
 }
 
 type DashboardUploadResponse struct {
@@ -23,6 +25,9 @@ type DashboardUploadResponse struct {
 	Version int    `json:"version"`
 }
 
+// PreconditionFailedMsg is the body of an HTTP 412 response.
+//
+// Deprecated: errors are returned as an *APIError, which holds these fields.
 type PreconditionFailedMsg struct {
 	Message string `json:"message"`
 	Status  string `json:"status"`
@@ -68,16 +73,17 @@ type GrafanaDashboardMeta struct {
 // GetDashboard will query the grafana api for a specific dashboard by UID
 // Reflects GET /api/dashboards/uid/:uid API call.
 func (r *Client) GetDashboard(uid string) (GrafanaDashboardFullWithMeta, error) {
+	return r.GetDashboardWithContext(context.Background(), uid)
+}
+
+// GetDashboardWithContext is the same as GetDashboard, with a context to cancel the request.
+func (r *Client) GetDashboardWithContext(ctx context.Context, uid string) (GrafanaDashboardFullWithMeta, error) {
 	var (
 		raw  []byte
 		dash GrafanaDashboardFullWithMeta
-		code int
 		err  error
 	)
-	if raw, code, err = r.get(fmt.Sprintf("api/dashboards/uid/%s", uid), nil); err != nil {
-		return dash, err
-	}
-	if code != 200 {
+	if raw, err = r.get(ctx, fmt.Sprintf("api/dashboards/uid/%s", uid), nil); err != nil {
 		return dash, err
 	}
 	if err = json.Unmarshal(raw, &dash); err != nil {
@@ -86,17 +92,74 @@ func (r *Client) GetDashboard(uid string) (GrafanaDashboardFullWithMeta, error)
 	return dash, nil
 }
 
+// NormalizeDashboard returns a copy of a dashboard without the fields that are
+// specific to a grafana instance, so that it can be compared with other copies.
+func NormalizeDashboard(dash map[string]interface{}) map[string]interface{} {
+	normalized := make(map[string]interface{}, len(dash))
+	for key, value := range dash {
+		normalized[key] = value
+	}
+	// don't compare the ID, version or iteration, they don't need to match
+	delete(normalized, "id")
+	delete(normalized, "version")
+	delete(normalized, "iteration")
+	return normalized
+}
+
+// DashboardsEqual compares two dashboards, ignoring instance specific fields
+func DashboardsEqual(a, b map[string]interface{}) bool {
+	return reflect.DeepEqual(NormalizeDashboard(a), NormalizeDashboard(b))
+}
+
+// SaveDashboardOptions controls where and how a dashboard is saved
+type SaveDashboardOptions struct {
+	FolderID  int
+	Overwrite bool
+	// Message is the change note of the saved version, shown in the history of the dashboard
+	Message string
+}
+
+// SaveDashboardResult describes the outcome of saving a dashboard
+type SaveDashboardResult struct {
+	Title    string
+	UID      string
+	Action   Action
+	Response DashboardUploadResponse
+}
+
 // SetDashboard will create or update a new/existing dashboard
 // Reflects POST /api/dashboards/db API call.
+//
+// Deprecated: use SaveDashboard, which also reports whether the dashboard was created, updated or unchanged.
 func (r *Client) SetDashboard(dash []byte, overwrite bool, folderID int) error {
+	return r.SetDashboardWithContext(context.Background(), dash, overwrite, folderID)
+}
+
+// SetDashboardWithContext is the same as SetDashboard, with a context to cancel the request.
+func (r *Client) SetDashboardWithContext(ctx context.Context, dash []byte, overwrite bool, folderID int) error {
+	_, err := r.SaveDashboardWithContext(ctx, dash, SaveDashboardOptions{
+		FolderID:  folderID,
+		Overwrite: overwrite,
+	})
+	return err
+}
+
+// SaveDashboard will create or update a new/existing dashboard, and report
+// what was done with it. No request is made if the dashboard is unchanged.
+// Reflects POST /api/dashboards/db API call.
+func (r *Client) SaveDashboard(dash []byte, opts SaveDashboardOptions) (SaveDashboardResult, error) {
+	return r.SaveDashboardWithContext(context.Background(), dash, opts)
+}
+
+// SaveDashboardWithContext is the same as SaveDashboard, with a context to cancel the request.
+func (r *Client) SaveDashboardWithContext(ctx context.Context, dash []byte, opts SaveDashboardOptions) (SaveDashboardResult, error) {
 	var (
 		raw               []byte
 		req               DashboardUploadRequest
 		resp              DashboardUploadResponse
-		code              int
+		result            SaveDashboardResult
 		payload           []byte
 		err               error
-		dashTitle         string
 		dashUID           string
 		existingDashboard GrafanaDashboardFullWithMeta
 		existingDashRaw   []byte
@@ -108,74 +171,124 @@ func (r *Client) SetDashboard(dash []byte, overwrite bool, folderID int) error {
 	var dashboardContents map[string]interface{}
 	_ = json.Unmarshal(dash, &dashboardContents)
 	// store dashboard's title for more friendly/usable messages
-	dashTitle = fmt.Sprintf("%v", dashboardContents["title"])
-	dashUID = fmt.Sprintf("%v", dashboardContents["uid"])
+	result.Title = fmt.Sprintf("%v", dashboardContents["title"])
+	dashUID, _ = dashboardContents["uid"].(string)
+	result.UID = dashUID
 
 	// crude check for a valid dashboard
 	if dashboardContents["panels"] == nil {
-		return fmt.Errorf("Not a dashboard")
+		return result, fmt.Errorf("Not a dashboard")
 	}
 
-	// check if the dashboard already exists
-	existingDashboard, _ = r.GetDashboard(dashUID)
-	if (GrafanaDashboardFullWithMeta{}) != existingDashboard {
+	// check if the dashboard already exists, a dashboard without a UID is always new
+	exists := false
+	if dashUID != "" {
+		existingDashboard, err = r.GetDashboardWithContext(ctx, dashUID)
+		if err != nil && !IsNotFound(err) {
+			return result, fmt.Errorf("Could not check if dashboard %s exists: %w", dashUID, err)
+		}
+		exists = err == nil
+	}
+	if exists {
 		// unmarshal the map into []bytes, then marshal back into map[string]interface{}
 		// this replicates the process of saving to file, and re-loading the data
 		existingDashRaw, _ = existingDashboard.Dashboard.MarshalJSON()
 		_ = json.Unmarshal(existingDashRaw, &existingDashMap)
 		// compare the two dashboards, we won't submit if it's a no-op update
-		// don't compare the ID, it doesn't need to match
-		upstreamCompareDash := existingDashMap
-		dnstreamCompareDash := dashboardContents
-		delete(upstreamCompareDash, "id")
-		delete(upstreamCompareDash, "version")
-		delete(dnstreamCompareDash, "id")
-		delete(dnstreamCompareDash, "version")
-		if reflect.DeepEqual(upstreamCompareDash, dnstreamCompareDash) {
-			fmt.Printf("No changes were made to the dashboard. Not updating\n")
-			return nil
+		if DashboardsEqual(existingDashMap, dashboardContents) && existingDashboard.Meta.FolderId == int64(opts.FolderID) {
+			result.Action = ActionUnchanged
+			return result, nil
 		}
+		result.Action = ActionUpdated
 	} else {
-		// dashboard was not found. set ID to null to create new dashboard
-		dashboardContents["id"] = nil
+		result.Action = ActionCreated
 	}
+	// the ID is specific to the instance the dashboard came from, the UID identifies it.
+	// set ID to null so the dashboard is created, or updated by its UID
+	dashboardContents["id"] = nil
 
 	// resolve the correct folder ID - it may not match
 
-	// construct a valid payload out of the dashboard, folderID, and overwrite flag
+	// construct a valid payload out of the dashboard, folderID, overwrite flag and message
 	req = DashboardUploadRequest{
 		Dashboard: dashboardContents,
-		FolderID:  folderID,
-		Overwrite: overwrite,
+		FolderID:  opts.FolderID,
+		Overwrite: opts.Overwrite,
+		Message:   opts.Message,
 	}
 	payload, _ = json.Marshal(req)
 
 	// submit the request
-	if raw, code, err = r.post("api/dashboards/db", nil, payload); err != nil {
-		return err
-	}
-	if code == 412 {
-		var badthings PreconditionFailedMsg
-		json.Unmarshal(raw, &badthings)
-		return fmt.Errorf("%s: %s", badthings.Status, badthings.Message)
-	} else if code != 200 {
-		// attempt to unmarshal the raw payload and display the error
-		var (
-			msg       string
-			badthings PreconditionFailedMsg
-		)
-		// fallback to the raw message
-		msg = string(raw)
-		// if possible, unmarshal and display a formatted error
-		if err = json.Unmarshal(raw, &badthings); err == nil {
-			msg = fmt.Sprintf("HTTP %d: %s", code, badthings.Message)
-		}
-		return fmt.Errorf(msg)
+	if raw, err = r.post(ctx, "api/dashboards/db", nil, payload); err != nil {
+		return result, err
 	}
 
 	if err = json.Unmarshal(raw, &resp); err != nil {
-		return err
+		return result, err
+	}
+	result.UID = resp.UID
+	result.Response = resp
+	return result, nil
+}
+
+// DashboardImportInput is the value of an input of a dashboard exported for sharing externally
+type DashboardImportInput struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	PluginID string `json:"pluginId,omitempty"`
+	Value    string `json:"value"`
+}
+
+// DashboardImportRequest is the payload of the import API
+type DashboardImportRequest struct {
+	Dashboard map[string]interface{} `json:"dashboard"`
+	Inputs    []DashboardImportInput `json:"inputs"`
+	FolderID  int                    `json:"folderId"`
+	Overwrite bool                   `json:"overwrite"`
+}
+
+// DashboardImportResponse describes an imported dashboard
+type DashboardImportResponse struct {
+	UID              string `json:"uid"`
+	Title            string `json:"title"`
+	Imported         bool   `json:"imported"`
+	DashboardID      int64  `json:"dashboardId"`
+	ImportedRevision int    `json:"importedRevision"`
+	Slug             string `json:"slug"`
+}
+
+// ImportDashboard imports a dashboard exported for sharing externally. Grafana replaces
+// the ${NAME} placeholders of the __inputs of the dashboard with the values of inputs.
+// Reflects POST /api/dashboards/import API call.
+func (r *Client) ImportDashboard(dash map[string]interface{}, inputs []DashboardImportInput, folderID int, overwrite bool) (DashboardImportResponse, error) {
+	return r.ImportDashboardWithContext(context.Background(), dash, inputs, folderID, overwrite)
+}
+
+// ImportDashboardWithContext is the same as ImportDashboard, with a context to cancel the request.
+func (r *Client) ImportDashboardWithContext(ctx context.Context, dash map[string]interface{}, inputs []DashboardImportInput, folderID int, overwrite bool) (DashboardImportResponse, error) {
+	var resp DashboardImportResponse
+	payload, _ := json.Marshal(DashboardImportRequest{
+		Dashboard: dash,
+		Inputs:    inputs,
+		FolderID:  folderID,
+		Overwrite: overwrite,
+	})
+	raw, err := r.post(ctx, "api/dashboards/import", nil, payload)
+	if err != nil {
+		return resp, err
 	}
-	fmt.Printf("Updated dashboard %s (%s) successfully!\n", dashTitle, resp.UID)
-	return nil
+	err = json.Unmarshal(raw, &resp)
+	return resp, err
+}
+
+// DeleteDashboard deletes the dashboard with the given UID
+// Reflects DELETE /api/dashboards/uid/:uid API call.
+func (r *Client) DeleteDashboard(uid string) error {
+	return r.DeleteDashboardWithContext(context.Background(), uid)
+}
+
+// DeleteDashboardWithContext is the same as DeleteDashboard, with a context to cancel the request.
+func (r *Client) DeleteDashboardWithContext(ctx context.Context, uid string) error {
+	_, err := r.delete(ctx, fmt.Sprintf("api/dashboards/uid/%s", uid))
+	return err
 }
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// GrafanaDataSource is a datasource of an organization.
+// Grafana never returns the values of secure fields, SecureJSONFields only lists which are set.
+type GrafanaDataSource struct {
+	ID    int64  `json:"id,omitempty"`
+	UID   string `json:"uid,omitempty"`
+	OrgID int64  `json:"orgId,omitempty"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	// TypeName is the name of the plugin of the datasource, like Prometheus for the type prometheus
+	TypeName string `json:"typeName,omitempty"`
+	Access   string `json:"access"`
+	URL      string `json:"url"`
+	Version  int    `json:"version,omitempty"`
+
+	User              string `json:"user,omitempty"`
+	Password          string `json:"password,omitempty"`
+	Database          string `json:"database,omitempty"`
+	BasicAuth         bool   `json:"basicAuth"`
+	BasicAuthUser     string `json:"basicAuthUser,omitempty"`
+	BasicAuthPassword string `json:"basicAuthPassword,omitempty"`
+	WithCredentials   bool   `json:"withCredentials"`
+	IsDefault         bool   `json:"isDefault"`
+	ReadOnly          bool   `json:"readOnly,omitempty"`
+
+	JSONData         map[string]interface{} `json:"jsonData,omitempty"`
+	SecureJSONData   map[string]string      `json:"secureJsonData,omitempty"`
+	SecureJSONFields map[string]bool        `json:"secureJsonFields,omitempty"`
+}
+
+// GetAllDataSources gets the datasources of the organization.
+// The list does not hold every setting of a datasource, use GetDataSource for those.
+// Reflects GET /api/datasources API call.
+func (r *Client) GetAllDataSources() ([]GrafanaDataSource, error) {
+	return r.GetAllDataSourcesWithContext(context.Background())
+}
+
+// GetAllDataSourcesWithContext is the same as GetAllDataSources, with a context to cancel the request.
+func (r *Client) GetAllDataSourcesWithContext(ctx context.Context) ([]GrafanaDataSource, error) {
+	var datasources []GrafanaDataSource
+	raw, err := r.get(ctx, "api/datasources", nil)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &datasources)
+	return datasources, err
+}
+
+// GetDataSource gets the datasource with the given ID.
+// Reflects GET /api/datasources/:id API call.
+func (r *Client) GetDataSource(id int64) (GrafanaDataSource, error) {
+	return r.GetDataSourceWithContext(context.Background(), id)
+}
+
+// GetDataSourceWithContext is the same as GetDataSource, with a context to cancel the request.
+func (r *Client) GetDataSourceWithContext(ctx context.Context, id int64) (GrafanaDataSource, error) {
+	var ds GrafanaDataSource
+	raw, err := r.get(ctx, fmt.Sprintf("api/datasources/%d", id), nil)
+	if err != nil {
+		return ds, err
+	}
+	err = json.Unmarshal(raw, &ds)
+	return ds, err
+}
+
+// CreateDataSource creates a datasource, and returns its ID.
+// Reflects POST /api/datasources API call.
+func (r *Client) CreateDataSource(ds GrafanaDataSource) (int64, error) {
+	return r.CreateDataSourceWithContext(context.Background(), ds)
+}
+
+// CreateDataSourceWithContext is the same as CreateDataSource, with a context to cancel the request.
+func (r *Client) CreateDataSourceWithContext(ctx context.Context, ds GrafanaDataSource) (int64, error) {
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	ds.ID = 0
+	payload, _ := json.Marshal(ds)
+	raw, err := r.post(ctx, "api/datasources", nil, payload)
+	if err != nil {
+		return 0, err
+	}
+	err = json.Unmarshal(raw, &created)
+	return created.ID, err
+}
+
+// UpdateDataSource replaces the settings of the datasource with the ID of ds.
+// Secure fields which are not in SecureJSONData keep their value.
+// Reflects PUT /api/datasources/:id API call.
+func (r *Client) UpdateDataSource(ds GrafanaDataSource) error {
+	return r.UpdateDataSourceWithContext(context.Background(), ds)
+}
+
+// UpdateDataSourceWithContext is the same as UpdateDataSource, with a context to cancel the request.
+func (r *Client) UpdateDataSourceWithContext(ctx context.Context, ds GrafanaDataSource) error {
+	payload, _ := json.Marshal(ds)
+	_, err := r.put(ctx, fmt.Sprintf("api/datasources/%d", ds.ID), nil, payload)
+	return err
+}
+
+// DeleteDataSource deletes the datasource with the given ID.
+// Reflects DELETE /api/datasources/:id API call.
+func (r *Client) DeleteDataSource(id int64) error {
+	return r.DeleteDataSourceWithContext(context.Background(), id)
+}
+
+// DeleteDataSourceWithContext is the same as DeleteDataSource, with a context to cancel the request.
+func (r *Client) DeleteDataSourceWithContext(ctx context.Context, id int64) error {
+	_, err := r.delete(ctx, fmt.Sprintf("api/datasources/%d", id))
+	return err
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// bodyExcerptLength is how much of an error response body is kept in an APIError
+const bodyExcerptLength = 512
+
+// APIError is returned when grafana responds to a request with an error status
+type APIError struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+	// Message and Status are the fields of grafana's error response, if it sent one.
+	// Status is a short identifier such as "version-mismatch" or "not-found".
+	Message string
+	Status  string
+	// Method and Path identify the request which failed
+	Method string
+	Path   string
+	// Body is the start of the response body
+	Body string
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Body
+	}
+	if e.Status != "" {
+		msg = fmt.Sprintf("%s: %s", e.Status, msg)
+	}
+	return fmt.Sprintf("%s %s: HTTP %d: %s", e.Method, e.Path, e.StatusCode, msg)
+}
+
+// newAPIError builds an APIError out of an error response
+func newAPIError(method, path string, code int, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: code,
+		Method:     method,
+		Path:       path,
+		Body:       string(body),
+	}
+	if len(apiErr.Body) > bodyExcerptLength {
+		apiErr.Body = apiErr.Body[:bodyExcerptLength] + "..."
+	}
+	var msg struct {
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &msg); err == nil {
+		apiErr.Message = msg.Message
+		apiErr.Status = msg.Status
+	}
+	return apiErr
+}
+
+// statusCode returns the status code of an APIError, or 0 for other errors
+func statusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound checks if an error was caused by a missing dashboard, folder or other object
+func IsNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+// IsVersionMismatch checks if an error was caused by the object being changed
+// in grafana since the version that was sent
+func IsVersionMismatch(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusPreconditionFailed {
+		return false
+	}
+	return apiErr.Status == "" || apiErr.Status == "version-mismatch"
+}
+
+// IsUnauthorized checks if an error was caused by missing or invalid credentials
+func IsUnauthorized(err error) bool {
+	return statusCode(err) == http.StatusUnauthorized
+}
+
+// IsForbidden checks if an error was caused by the credentials lacking a permission
+func IsForbidden(err error) bool {
+	return statusCode(err) == http.StatusForbidden
+}
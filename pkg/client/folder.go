@@ -2,13 +2,19 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/grafana/grafana/pkg/models"
 )
 
+// UpdateFolderErrorResponse is the body of an error response to a folder update.
+//
+// Deprecated: errors are returned as an *APIError, which holds these fields.
 type UpdateFolderErrorResponse = struct {
 	Message string `json:"message"`
 	Status  string `json:"status"`
@@ -19,6 +25,11 @@ type GrafanaFolder struct {
 	UID   string `json:"uid"`
 	Title string `json:"title"`
 	URL   string `json:"url"`
+	// ParentUID is the UID of the folder this folder is nested in, empty for a folder at the top level.
+	// Grafana supports nested folders since version 10.
+	ParentUID string `json:"parentUid,omitempty"`
+	// Parents are the folders this folder is nested in, from the top level down
+	Parents []GrafanaFolder `json:"parents,omitempty"`
 
 	HasACL   bool `json:"hasAcl"`
 	CanSave  bool `json:"canSave"`
@@ -32,42 +43,137 @@ type GrafanaFolder struct {
 	Version   int       `json:"version"`
 }
 
-// GetAllFolders gets all folders.
+// GetAllFolders gets all folders, including nested folders. Parents are listed before their children.
 // Reflects GET /api/folders API call.
 func (r *Client) GetAllFolders() ([]GrafanaFolder, error) {
+	return r.GetAllFoldersWithContext(context.Background())
+}
+
+// GetAllFoldersWithContext is the same as GetAllFolders, with a context to cancel the request.
+func (r *Client) GetAllFoldersWithContext(ctx context.Context) ([]GrafanaFolder, error) {
+	return r.GetNestedFoldersWithContext(ctx, "")
+}
+
+// GetNestedFolders gets the folders nested in the folder with the given UID, at any depth,
+// or all folders if parentUID is empty. Parents are listed before their children.
+// Reflects GET /api/folders?parentUid=:uid API calls, one for every folder.
+func (r *Client) GetNestedFolders(parentUID string) ([]GrafanaFolder, error) {
+	return r.GetNestedFoldersWithContext(context.Background(), parentUID)
+}
+
+// GetNestedFoldersWithContext is the same as GetNestedFolders, with a context to cancel the request.
+func (r *Client) GetNestedFoldersWithContext(ctx context.Context, parentUID string) ([]GrafanaFolder, error) {
 	var (
-		raw     []byte
-		code    int
-		folders []GrafanaFolder
-		err     error
+		all     []GrafanaFolder
+		visited = map[string]bool{parentUID: true}
 	)
-	if raw, code, err = r.get("api/folders", nil); err != nil {
-		return nil, err
+	// the folders are listed level by level, grafana lists the children of one folder at a time
+	parents := []string{parentUID}
+	for len(parents) > 0 {
+		var next []string
+		for _, uid := range parents {
+			folders, err := r.GetFoldersWithContext(ctx, uid)
+			if err != nil {
+				return nil, err
+			}
+			for _, fo := range folders {
+				// a folder is only listed once, even if grafana reports a cycle of parents
+				if visited[fo.UID] {
+					continue
+				}
+				visited[fo.UID] = true
+				all = append(all, fo)
+				next = append(next, fo.UID)
+			}
+		}
+		parents = next
+	}
+	return all, nil
+}
+
+// folderPageSize is the number of folders requested at once, the most grafana returns by default
+const folderPageSize = 1000
+
+// GetFolders gets the folders nested in the folder with the given UID, or the folders
+// at the top level if parentUID is empty.
+// Reflects GET /api/folders?parentUid=:uid API call, for every page of folders.
+func (r *Client) GetFolders(parentUID string) ([]GrafanaFolder, error) {
+	return r.GetFoldersWithContext(context.Background(), parentUID)
+}
+
+// GetFoldersWithContext is the same as GetFolders, with a context to cancel the request.
+func (r *Client) GetFoldersWithContext(ctx context.Context, parentUID string) ([]GrafanaFolder, error) {
+	var folders []GrafanaFolder
+	seen := map[string]bool{}
+	for page := 1; ; page++ {
+		var (
+			raw     []byte
+			results []GrafanaFolder
+			err     error
+		)
+		params := url.Values{}
+		params.Set("limit", strconv.Itoa(folderPageSize))
+		params.Set("page", strconv.Itoa(page))
+		if parentUID != "" {
+			params.Set("parentUid", parentUID)
+		}
+		if raw, err = r.get(ctx, "api/folders", params); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(raw, &results); err != nil {
+			return nil, err
+		}
+		added := 0
+		for _, fo := range results {
+			if !seen[fo.UID] {
+				seen[fo.UID] = true
+				folders = append(folders, fo)
+				added++
+			}
+		}
+		// older versions of grafana ignore page, and list the same folders again
+		if len(results) < folderPageSize || added == 0 {
+			break
+		}
 	}
-	if code != 200 {
-		return nil, fmt.Errorf("HTTP error %d: returns %s", code, raw)
+	if parentUID == "" {
+		return folders, nil
 	}
-	err = json.Unmarshal(raw, &folders)
-	return folders, err
+
+	children := folders[:0]
+	for _, fo := range folders {
+		// versions of grafana without nested folders ignore parentUid, and list
+		// the top level, with the parent in it. A folder is never its own child.
+		if fo.UID == parentUID {
+			return nil, nil
+		}
+		// the list may not tell the parent, it is the folder that was asked for
+		if fo.ParentUID == "" {
+			fo.ParentUID = parentUID
+		}
+		if fo.ParentUID == parentUID {
+			children = append(children, fo)
+		}
+	}
+	return children, nil
 }
 
 // GetFolder gets a folder with the given UID.
 // Reflects GET /api/folders/:uid API call.
 func (r *Client) GetFolder(uid string) (GrafanaFolder, error) {
+	return r.GetFolderWithContext(context.Background(), uid)
+}
+
+// GetFolderWithContext is the same as GetFolder, with a context to cancel the request.
+func (r *Client) GetFolderWithContext(ctx context.Context, uid string) (GrafanaFolder, error) {
 	var (
-		raw  []byte
-		fo   GrafanaFolder
-		code int
-		err  error
+		raw []byte
+		fo  GrafanaFolder
+		err error
 	)
-	if raw, code, err = r.get(fmt.Sprintf("api/folders/%s", uid), nil); err != nil {
+	if raw, err = r.get(ctx, fmt.Sprintf("api/folders/%s", uid), nil); err != nil {
 		return GrafanaFolder{}, err
 	}
-	if code == 404 {
-		return GrafanaFolder{}, nil
-	} else if code != 200 {
-		return GrafanaFolder{}, fmt.Errorf("HTTP error %d: returns %s", code, raw)
-	}
 
 	if err = json.Unmarshal(raw, &fo); err != nil {
 		return GrafanaFolder{}, fmt.Errorf("unmarshal board with meta: %s\n%s", err, raw)
@@ -80,51 +186,108 @@ func (r *Client) GetFolder(uid string) (GrafanaFolder, error) {
 // If a folder with the same UID exists, it will be updated
 // If UID is omitted, a new folder will be created.
 // If the folder does not exist, it will be created.
+//
+// Deprecated: use SaveFolder, which also reports whether the folder was created, updated or unchanged.
 func (r *Client) SetFolder(folder GrafanaFolder, overwrite bool) (GrafanaFolder, error) {
+	return r.SetFolderWithContext(context.Background(), folder, overwrite)
+}
+
+// SetFolderWithContext is the same as SetFolder, with a context to cancel the request.
+func (r *Client) SetFolderWithContext(ctx context.Context, folder GrafanaFolder, overwrite bool) (GrafanaFolder, error) {
+	fo, _, err := r.SaveFolderWithContext(ctx, folder, overwrite)
+	return fo, err
+}
+
+// SaveFolder behaves like SetFolder, but also reports what was done with the folder
+func (r *Client) SaveFolder(folder GrafanaFolder, overwrite bool) (GrafanaFolder, Action, error) {
+	return r.SaveFolderWithContext(context.Background(), folder, overwrite)
+}
+
+// SaveFolderWithContext is the same as SaveFolder, with a context to cancel the request.
+func (r *Client) SaveFolderWithContext(ctx context.Context, folder GrafanaFolder, overwrite bool) (GrafanaFolder, Action, error) {
 	var (
 		fo  GrafanaFolder
 		err error
 	)
 	// search for the folder by UID
-	if fo, err = r.GetFolder(folder.UID); err != nil {
-		return GrafanaFolder{}, fmt.Errorf("Could not check if folder %s exists: %w", folder.UID, err)
+	fo, err = r.GetFolderWithContext(ctx, folder.UID)
+	if err != nil && !IsNotFound(err) {
+		return GrafanaFolder{}, "", fmt.Errorf("Could not check if folder %s exists: %w", folder.UID, err)
 	}
 
-	if fo.UID == "" {
+	if IsNotFound(err) {
 		// folder doesn't exist
-		fmt.Printf("Creating new folder %s (%s)", folder.Title, folder.UID)
-		return r.createFolder(folder.UID, folder.Title)
+		fo, err = r.CreateNestedFolderWithContext(ctx, folder.UID, folder.Title, folder.ParentUID)
+		if err == nil && fo.ParentUID != folder.ParentUID {
+			// grafana ignores the parent if it doesn't support nested folders
+			err = fmt.Errorf("folder %s was created at the top level, grafana does not support nested folders", folder.UID)
+		}
+		return fo, ActionCreated, err
+	}
+
+	if fo.ParentUID != folder.ParentUID {
+		// the folder exists, grafana doesn't know the API if it doesn't support nested folders
+		if fo, err = r.MoveFolderWithContext(ctx, folder.UID, folder.ParentUID); IsNotFound(err) {
+			return fo, ActionUpdated, fmt.Errorf("unable to move folder %s, grafana may not support nested folders: %w", folder.UID, err)
+		} else if err != nil {
+			return fo, ActionUpdated, err
+		}
+		if fo.Title == folder.Title {
+			return fo, ActionUpdated, nil
+		}
 	}
 
 	// check that we actually need to update something
 	if fo.Title != folder.Title {
-		return r.updateFolder(folder.UID, folder.Title, folder.Version, overwrite)
+		fo, err = r.UpdateFolderWithContext(ctx, folder.UID, folder.Title, folder.Version, overwrite)
+		return fo, ActionUpdated, err
 	}
 
 	// return the upstream folder, it has the correct folderId
-	return fo, nil
+	return fo, ActionUnchanged, nil
+}
+
+// CreateFolder creates a folder. If uid is empty, grafana generates one.
+// Reflects POST /api/folders API call.
+func (r *Client) CreateFolder(uid string, title string) (GrafanaFolder, error) {
+	return r.CreateFolderWithContext(context.Background(), uid, title)
+}
+
+// CreateFolderWithContext is the same as CreateFolder, with a context to cancel the request.
+func (r *Client) CreateFolderWithContext(ctx context.Context, uid string, title string) (GrafanaFolder, error) {
+	return r.CreateNestedFolderWithContext(ctx, uid, title, "")
+}
+
+// CreateNestedFolder creates a folder inside the folder with the given parent UID,
+// or at the top level if parentUID is empty. If uid is empty, grafana generates one.
+// Reflects POST /api/folders API call.
+func (r *Client) CreateNestedFolder(uid string, title string, parentUID string) (GrafanaFolder, error) {
+	return r.CreateNestedFolderWithContext(context.Background(), uid, title, parentUID)
 }
 
-func (r *Client) createFolder(uid string, title string) (GrafanaFolder, error) {
+// CreateNestedFolderWithContext is the same as CreateNestedFolder, with a context to cancel the request.
+func (r *Client) CreateNestedFolderWithContext(ctx context.Context, uid string, title string, parentUID string) (GrafanaFolder, error) {
 	var (
-		raw      []byte
-		fo       GrafanaFolder
-		code     int
-		err      error
-		toCreate models.CreateFolderCommand
-		payload  []byte
+		raw     []byte
+		fo      GrafanaFolder
+		err     error
+		payload []byte
 	)
-	toCreate = models.CreateFolderCommand{
-		Uid:   uid,
-		Title: title,
+	// the vendored models predate nested folders, and have no parentUid
+	toCreate := struct {
+		models.CreateFolderCommand
+		ParentUID string `json:"parentUid,omitempty"`
+	}{
+		CreateFolderCommand: models.CreateFolderCommand{
+			Uid:   uid,
+			Title: title,
+		},
+		ParentUID: parentUID,
 	}
 	payload, _ = json.Marshal(toCreate)
-	if raw, code, err = r.post("api/folders/", nil, payload); err != nil {
+	if raw, err = r.post(ctx, "api/folders/", nil, payload); err != nil {
 		return GrafanaFolder{}, err
 	}
-	if code != 200 {
-		return GrafanaFolder{}, fmt.Errorf("HTTP error %d, returns %s", code, raw)
-	}
 	dec := json.NewDecoder(bytes.NewReader(raw))
 	dec.UseNumber()
 	if err := dec.Decode(&fo); err != nil {
@@ -133,14 +296,22 @@ func (r *Client) createFolder(uid string, title string) (GrafanaFolder, error) {
 	return fo, err
 }
 
-func (r *Client) updateFolder(uid string, title string, version int, overwrite bool) (GrafanaFolder, error) {
+// UpdateFolder changes the title of the folder with the given UID.
+// The version is the version of the folder the change is based on. If the folder
+// was changed since, the update fails with a version mismatch, see IsVersionMismatch,
+// unless overwrite is set.
+// Reflects PUT /api/folders/:uid API call.
+func (r *Client) UpdateFolder(uid string, title string, version int, overwrite bool) (GrafanaFolder, error) {
+	return r.UpdateFolderWithContext(context.Background(), uid, title, version, overwrite)
+}
+
+// UpdateFolderWithContext is the same as UpdateFolder, with a context to cancel the request.
+func (r *Client) UpdateFolderWithContext(ctx context.Context, uid string, title string, version int, overwrite bool) (GrafanaFolder, error) {
 	var (
 		raw      []byte
 		fo       GrafanaFolder
-		code     int
 		err      error
 		toUpdate models.UpdateFolderCommand
-		failMsg  UpdateFolderErrorResponse
 		payload  []byte
 	)
 	toUpdate = models.UpdateFolderCommand{
@@ -150,16 +321,10 @@ func (r *Client) updateFolder(uid string, title string, version int, overwrite b
 		Overwrite: overwrite,
 	}
 	payload, _ = json.Marshal(toUpdate)
-	if raw, code, err = r.put(fmt.Sprintf("api/folders/%s", uid), nil, payload); err != nil {
+	// a version mismatch is returned as an *APIError, see IsVersionMismatch
+	if raw, err = r.put(ctx, fmt.Sprintf("api/folders/%s", uid), nil, payload); err != nil {
 		return GrafanaFolder{}, err
 	}
-	if code == 412 {
-		// unpack the response and provide the message back to the user
-		if err := json.Unmarshal(raw, &failMsg); err != nil {
-			return GrafanaFolder{}, fmt.Errorf("Received HTTP 412 but was unable to understand server message: %w", err)
-		}
-		return GrafanaFolder{}, fmt.Errorf(fmt.Sprintf("%s: %s\n", failMsg.Status, failMsg.Message))
-	}
 	dec := json.NewDecoder(bytes.NewReader(raw))
 	dec.UseNumber()
 	if err := dec.Decode(&fo); err != nil {
@@ -167,3 +332,40 @@ func (r *Client) updateFolder(uid string, title string, version int, overwrite b
 	}
 	return fo, nil
 }
+
+// MoveFolder moves the folder with the given UID into the folder with the given parent UID,
+// or to the top level if parentUID is empty.
+// Reflects POST /api/folders/:uid/move API call.
+func (r *Client) MoveFolder(uid string, parentUID string) (GrafanaFolder, error) {
+	return r.MoveFolderWithContext(context.Background(), uid, parentUID)
+}
+
+// MoveFolderWithContext is the same as MoveFolder, with a context to cancel the request.
+func (r *Client) MoveFolderWithContext(ctx context.Context, uid string, parentUID string) (GrafanaFolder, error) {
+	var (
+		raw []byte
+		fo  GrafanaFolder
+		err error
+	)
+	payload, _ := json.Marshal(map[string]string{"parentUid": parentUID})
+	if raw, err = r.post(ctx, fmt.Sprintf("api/folders/%s/move", uid), nil, payload); err != nil {
+		return GrafanaFolder{}, err
+	}
+	if err = json.Unmarshal(raw, &fo); err != nil {
+		return GrafanaFolder{}, fmt.Errorf("unable to parse server message: %w", err)
+	}
+	return fo, nil
+}
+
+// DeleteFolder deletes the folder with the given UID.
+// Grafana also deletes every dashboard in the folder.
+// Reflects DELETE /api/folders/:uid API call.
+func (r *Client) DeleteFolder(uid string) error {
+	return r.DeleteFolderWithContext(context.Background(), uid)
+}
+
+// DeleteFolderWithContext is the same as DeleteFolder, with a context to cancel the request.
+func (r *Client) DeleteFolderWithContext(ctx context.Context, uid string) error {
+	_, err := r.delete(ctx, fmt.Sprintf("api/folders/%s", uid))
+	return err
+}
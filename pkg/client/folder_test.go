@@ -0,0 +1,156 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// folderServer serves folders like GET /api/folders, in pages.
+// With nested, it lists the children of parentUid, otherwise it ignores parentUid
+// like versions of grafana without nested folders. With withParents, the listed
+// folders tell their parentUid. The caller closes the server.
+func folderServer(t *testing.T, folders []GrafanaFolder, nested, withParents bool) (*Client, *httptest.Server) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		page, _ := strconv.Atoi(query.Get("page"))
+		if limit == 0 || page == 0 {
+			t.Errorf("folders requested without a page: %s", r.URL)
+		}
+		listed := []GrafanaFolder{}
+		for _, fol := range folders {
+			if nested && fol.ParentUID != query.Get("parentUid") {
+				continue
+			}
+			if !withParents {
+				fol.ParentUID = ""
+			}
+			listed = append(listed, fol)
+		}
+		start, end := (page-1)*limit, page*limit
+		if start > len(listed) {
+			start = len(listed)
+		}
+		if end > len(listed) {
+			end = len(listed)
+		}
+		json.NewEncoder(w).Encode(listed[start:end])
+	}))
+	return NewClient(srv.URL, "key", srv.Client()), srv
+}
+
+var nestedFolders = []GrafanaFolder{
+	{ID: 1, UID: "top", Title: "Top"},
+	{ID: 2, UID: "child", Title: "Child", ParentUID: "top"},
+	{ID: 3, UID: "grandchild", Title: "Grandchild", ParentUID: "child"},
+	{ID: 4, UID: "other", Title: "Other"},
+}
+
+// describe lists folders as uid<parentUid, in order
+func describe(folders []GrafanaFolder) string {
+	var list []string
+	for _, fol := range folders {
+		list = append(list, fol.UID+"<"+fol.ParentUID)
+	}
+	return strings.Join(list, ",")
+}
+
+func TestGetAllFolders(t *testing.T) {
+	tests := []struct {
+		name        string
+		nested      bool
+		withParents bool
+		want        string
+	}{
+		{name: "nested folders", nested: true, withParents: true, want: "top<,other<,child<top,grandchild<child"},
+		{name: "list without parentUid", nested: true, want: "top<,other<,child<top,grandchild<child"},
+		{name: "grafana without nested folders", want: "top<,child<,grandchild<,other<"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := folderServer(t, nestedFolders, tt.nested, tt.withParents)
+			defer srv.Close()
+			folders, err := c.GetAllFolders()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describe(folders); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetNestedFolders(t *testing.T) {
+	c, srv := folderServer(t, nestedFolders, true, false)
+	defer srv.Close()
+	folders, err := c.GetNestedFolders("top")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := describe(folders), "child<top,grandchild<child"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// grafana without nested folders lists the top level, which holds the parent itself
+	flat, flatSrv := folderServer(t, nestedFolders, false, false)
+	defer flatSrv.Close()
+	folders, err = flat.GetNestedFolders("top")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(folders) != 0 {
+		t.Errorf("got %s, want no nested folders", describe(folders))
+	}
+}
+
+func TestGetFoldersPages(t *testing.T) {
+	var many []GrafanaFolder
+	for i := 1; i <= 2*folderPageSize+1; i++ {
+		many = append(many, GrafanaFolder{ID: int64(i), UID: fmt.Sprintf("f%d", i)})
+	}
+	c, srv := folderServer(t, many, true, true)
+	defer srv.Close()
+	folders, err := c.GetFolders("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(folders) != len(many) {
+		t.Errorf("got %d folders, want %d", len(folders), len(many))
+	}
+}
+
+func TestGetFoldersIgnoredPage(t *testing.T) {
+	var many []GrafanaFolder
+	for i := 1; i <= folderPageSize+1; i++ {
+		many = append(many, GrafanaFolder{ID: int64(i), UID: fmt.Sprintf("f%d", i)})
+	}
+	requests := 0
+	// older versions of grafana ignore page and limit, and list every folder each time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > 3 {
+			t.Errorf("the same folders were requested %d times", requests)
+			w.Write([]byte("[]"))
+			return
+		}
+		json.NewEncoder(w).Encode(many)
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, "key", srv.Client())
+	folders, err := c.GetFolders("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(folders) != len(many) {
+		t.Errorf("got %d folders, want %d", len(folders), len(many))
+	}
+	if requests != 2 {
+		t.Errorf("got %d requests, want to stop at the first repeated page", requests)
+	}
+}
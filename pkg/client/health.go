@@ -0,0 +1,30 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Health describes a grafana instance
+type Health struct {
+	Commit   string `json:"commit"`
+	Database string `json:"database"`
+	Version  string `json:"version"`
+}
+
+// GetHealth gets the version of grafana and the state of its database.
+// Reflects GET /api/health API call.
+func (r *Client) GetHealth() (Health, error) {
+	return r.GetHealthWithContext(context.Background())
+}
+
+// GetHealthWithContext is the same as GetHealth, with a context to cancel the request.
+func (r *Client) GetHealthWithContext(ctx context.Context) (Health, error) {
+	var health Health
+	raw, err := r.get(ctx, "api/health", nil)
+	if err != nil {
+		return health, err
+	}
+	err = json.Unmarshal(raw, &health)
+	return health, err
+}
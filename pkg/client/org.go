@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// GrafanaOrg is an organization of a grafana instance
+type GrafanaOrg struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Role is the role of the authenticated user in the organization,
+	// it is only set by GetUserOrgs
+	Role string `json:"role,omitempty"`
+}
+
+// OrgID returns the ID of the organization set with SetOrgID, or 0
+func (r *Client) OrgID() int64 {
+	return r.orgID
+}
+
+// GetCurrentOrg gets the organization that requests act on.
+// Reflects GET /api/org API call.
+func (r *Client) GetCurrentOrg() (GrafanaOrg, error) {
+	return r.GetCurrentOrgWithContext(context.Background())
+}
+
+// GetCurrentOrgWithContext is the same as GetCurrentOrg, with a context to cancel the request.
+func (r *Client) GetCurrentOrgWithContext(ctx context.Context) (GrafanaOrg, error) {
+	var org GrafanaOrg
+	raw, err := r.get(ctx, "api/org", nil)
+	if err != nil {
+		return org, err
+	}
+	err = json.Unmarshal(raw, &org)
+	return org, err
+}
+
+// GetAllOrgs gets every organization. Only server admins are allowed to.
+// Reflects GET /api/orgs API call.
+func (r *Client) GetAllOrgs() ([]GrafanaOrg, error) {
+	return r.GetAllOrgsWithContext(context.Background())
+}
+
+// GetAllOrgsWithContext is the same as GetAllOrgs, with a context to cancel the request.
+func (r *Client) GetAllOrgsWithContext(ctx context.Context) ([]GrafanaOrg, error) {
+	var orgs []GrafanaOrg
+	raw, err := r.get(ctx, "api/orgs", nil)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &orgs)
+	return orgs, err
+}
+
+// GetUserOrgs gets the organizations the authenticated user is a member of.
+// Reflects GET /api/user/orgs API call.
+func (r *Client) GetUserOrgs() ([]GrafanaOrg, error) {
+	return r.GetUserOrgsWithContext(context.Background())
+}
+
+// GetUserOrgsWithContext is the same as GetUserOrgs, with a context to cancel the request.
+func (r *Client) GetUserOrgsWithContext(ctx context.Context) ([]GrafanaOrg, error) {
+	var memberships []struct {
+		OrgID int64  `json:"orgId"`
+		Name  string `json:"name"`
+		Role  string `json:"role"`
+	}
+	raw, err := r.get(ctx, "api/user/orgs", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(raw, &memberships); err != nil {
+		return nil, err
+	}
+	orgs := make([]GrafanaOrg, 0, len(memberships))
+	for _, m := range memberships {
+		orgs = append(orgs, GrafanaOrg{ID: m.OrgID, Name: m.Name, Role: m.Role})
+	}
+	return orgs, nil
+}
+
+// GetOrgByName gets an organization by its name. Only server admins are allowed to.
+// Reflects GET /api/orgs/name/:name API call.
+func (r *Client) GetOrgByName(name string) (GrafanaOrg, error) {
+	return r.GetOrgByNameWithContext(context.Background(), name)
+}
+
+// GetOrgByNameWithContext is the same as GetOrgByName, with a context to cancel the request.
+func (r *Client) GetOrgByNameWithContext(ctx context.Context, name string) (GrafanaOrg, error) {
+	var org GrafanaOrg
+	raw, err := r.get(ctx, fmt.Sprintf("api/orgs/name/%s", url.PathEscape(name)), nil)
+	if err != nil {
+		return org, err
+	}
+	err = json.Unmarshal(raw, &org)
+	return org, err
+}
+
+// CreateOrg creates an organization, and returns its ID.
+// Reflects POST /api/orgs API call.
+func (r *Client) CreateOrg(name string) (int64, error) {
+	return r.CreateOrgWithContext(context.Background(), name)
+}
+
+// CreateOrgWithContext is the same as CreateOrg, with a context to cancel the request.
+func (r *Client) CreateOrgWithContext(ctx context.Context, name string) (int64, error) {
+	var created struct {
+		OrgID int64 `json:"orgId"`
+	}
+	payload, _ := json.Marshal(map[string]string{"name": name})
+	raw, err := r.post(ctx, "api/orgs", nil, payload)
+	if err != nil {
+		return 0, err
+	}
+	err = json.Unmarshal(raw, &created)
+	return created.OrgID, err
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetOrgByName(t *testing.T) {
+	tests := []struct {
+		name, base, want string
+	}{
+		{name: "Main Org.", want: "/api/orgs/name/Main%20Org."},
+		{name: "Ops/Team A", want: "/api/orgs/name/Ops%2FTeam%20A"},
+		{name: "50%?#", want: "/api/orgs/name/50%25%3F%23"},
+		{name: "Ops/Team A", base: "/grafana/", want: "/grafana/api/orgs/name/Ops%2FTeam%20A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.URL.EscapedPath(); got != tt.want {
+					t.Errorf("requested %s, want %s", got, tt.want)
+				}
+				json.NewEncoder(w).Encode(GrafanaOrg{ID: 2, Name: tt.name})
+			}))
+			defer srv.Close()
+			c := NewClient(srv.URL+tt.base, "key", srv.Client())
+			org, err := c.GetOrgByName(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if org.ID != 2 {
+				t.Errorf("got org %d, want 2", org.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Permission levels of folder and dashboard permissions
+const (
+	PermissionView  = 1
+	PermissionEdit  = 2
+	PermissionAdmin = 4
+)
+
+// GrafanaPermission is an entry of the permissions (ACL) of a folder or dashboard.
+// It grants a permission to either a role, a team or a user.
+type GrafanaPermission struct {
+	ID          int64     `json:"id"`
+	FolderID    int64     `json:"folderId"`
+	DashboardID int64     `json:"dashboardId"`
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"`
+
+	UserID    int64  `json:"userId"`
+	UserLogin string `json:"userLogin"`
+	UserEmail string `json:"userEmail"`
+	TeamID    int64  `json:"teamId"`
+	Team      string `json:"team"`
+	Role      string `json:"role"`
+
+	Permission     int    `json:"permission"`
+	PermissionName string `json:"permissionName"`
+	// Inherited is set on the permissions a dashboard inherits from its folder
+	Inherited bool `json:"inherited"`
+}
+
+// PermissionUpdate grants a permission to a role, a team or a user.
+// Exactly one of Role, TeamID and UserID must be set.
+type PermissionUpdate struct {
+	Role       string `json:"role,omitempty"`
+	TeamID     int64  `json:"teamId,omitempty"`
+	UserID     int64  `json:"userId,omitempty"`
+	Permission int    `json:"permission"`
+}
+
+// GrafanaTeam is a team of an organization
+type GrafanaTeam struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// GrafanaOrgUser is a user of an organization
+type GrafanaOrgUser struct {
+	ID    int64  `json:"userId"`
+	Login string `json:"login"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// GetFolderPermissions gets the permissions of the folder with the given UID.
+// Reflects GET /api/folders/:uid/permissions API call.
+func (r *Client) GetFolderPermissions(uid string) ([]GrafanaPermission, error) {
+	return r.GetFolderPermissionsWithContext(context.Background(), uid)
+}
+
+// GetFolderPermissionsWithContext is the same as GetFolderPermissions, with a context to cancel the request.
+func (r *Client) GetFolderPermissionsWithContext(ctx context.Context, uid string) ([]GrafanaPermission, error) {
+	return r.getPermissions(ctx, fmt.Sprintf("api/folders/%s/permissions", uid))
+}
+
+// UpdateFolderPermissions replaces the permissions of the folder with the given UID.
+// Reflects POST /api/folders/:uid/permissions API call.
+func (r *Client) UpdateFolderPermissions(uid string, items []PermissionUpdate) error {
+	return r.UpdateFolderPermissionsWithContext(context.Background(), uid, items)
+}
+
+// UpdateFolderPermissionsWithContext is the same as UpdateFolderPermissions, with a context to cancel the request.
+func (r *Client) UpdateFolderPermissionsWithContext(ctx context.Context, uid string, items []PermissionUpdate) error {
+	return r.updatePermissions(ctx, fmt.Sprintf("api/folders/%s/permissions", uid), items)
+}
+
+// GetDashboardPermissions gets the permissions of the dashboard with the given UID,
+// including the permissions it inherits from its folder.
+// Reflects GET /api/dashboards/uid/:uid/permissions API call.
+func (r *Client) GetDashboardPermissions(uid string) ([]GrafanaPermission, error) {
+	return r.GetDashboardPermissionsWithContext(context.Background(), uid)
+}
+
+// GetDashboardPermissionsWithContext is the same as GetDashboardPermissions, with a context to cancel the request.
+func (r *Client) GetDashboardPermissionsWithContext(ctx context.Context, uid string) ([]GrafanaPermission, error) {
+	return r.getPermissions(ctx, fmt.Sprintf("api/dashboards/uid/%s/permissions", uid))
+}
+
+// UpdateDashboardPermissions replaces the permissions of the dashboard with the given UID.
+// The permissions inherited from its folder are not affected.
+// Reflects POST /api/dashboards/uid/:uid/permissions API call.
+func (r *Client) UpdateDashboardPermissions(uid string, items []PermissionUpdate) error {
+	return r.UpdateDashboardPermissionsWithContext(context.Background(), uid, items)
+}
+
+// UpdateDashboardPermissionsWithContext is the same as UpdateDashboardPermissions, with a context to cancel the request.
+func (r *Client) UpdateDashboardPermissionsWithContext(ctx context.Context, uid string, items []PermissionUpdate) error {
+	return r.updatePermissions(ctx, fmt.Sprintf("api/dashboards/uid/%s/permissions", uid), items)
+}
+
+func (r *Client) getPermissions(ctx context.Context, query string) ([]GrafanaPermission, error) {
+	var permissions []GrafanaPermission
+	raw, err := r.get(ctx, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &permissions)
+	return permissions, err
+}
+
+func (r *Client) updatePermissions(ctx context.Context, query string, items []PermissionUpdate) error {
+	if items == nil {
+		items = []PermissionUpdate{}
+	}
+	payload, _ := json.Marshal(map[string][]PermissionUpdate{"items": items})
+	_, err := r.post(ctx, query, nil, payload)
+	return err
+}
+
+// SearchTeams searches the teams of the organization by name.
+// Reflects GET /api/teams/search API call.
+func (r *Client) SearchTeams(name string) ([]GrafanaTeam, error) {
+	return r.SearchTeamsWithContext(context.Background(), name)
+}
+
+// SearchTeamsWithContext is the same as SearchTeams, with a context to cancel the request.
+func (r *Client) SearchTeamsWithContext(ctx context.Context, name string) ([]GrafanaTeam, error) {
+	var result struct {
+		Teams []GrafanaTeam `json:"teams"`
+	}
+	params := url.Values{}
+	params.Set("name", name)
+	raw, err := r.get(ctx, "api/teams/search", params)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &result)
+	return result.Teams, err
+}
+
+// LookupOrgUsers searches the users of the organization by login, email or name.
+// Reflects GET /api/org/users/lookup API call.
+func (r *Client) LookupOrgUsers(query string) ([]GrafanaOrgUser, error) {
+	return r.LookupOrgUsersWithContext(context.Background(), query)
+}
+
+// LookupOrgUsersWithContext is the same as LookupOrgUsers, with a context to cancel the request.
+func (r *Client) LookupOrgUsersWithContext(ctx context.Context, query string) ([]GrafanaOrgUser, error) {
+	var users []GrafanaOrgUser
+	params := url.Values{}
+	params.Set("query", query)
+	raw, err := r.get(ctx, "api/org/users/lookup", params)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &users)
+	return users, err
+}
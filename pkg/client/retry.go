@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how requests that fail with a temporary error are retried
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a request is attempted, including the
+	// first attempt. Requests are not retried if it is 1 or less.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry. It doubles on every
+	// following retry, up to MaxBackoff. Random jitter is applied to each delay.
+	MinBackoff time.Duration
+	// MaxBackoff is the longest delay before a retry, including the delays
+	// asked for by the server with Retry-After. Zero doesn't limit the delay.
+	MaxBackoff time.Duration
+	// RetryStatuses are the HTTP status codes that are retried
+	RetryStatuses []int
+	// RetryNonIdempotent allows POST and PATCH requests to be retried on any of
+	// the RetryStatuses, or on connection errors. Otherwise they are only
+	// retried when they were rejected with 429 Too Many Requests.
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryStatuses are the status codes Grafana returns for temporary errors
+var DefaultRetryStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// SetRetryPolicy sets how requests that fail with a temporary error are retried.
+// By default, requests are not retried.
+func (r *Client) SetRetryPolicy(policy RetryPolicy) {
+	r.retry = policy
+}
+
+// SetRateLimit limits the client to the given number of requests per second,
+// allowing bursts of up to burst requests. A rate of 0 removes the limit.
+func (r *Client) SetRateLimit(requestsPerSecond float64, burst int) {
+	if requestsPerSecond <= 0 {
+		r.limiter = nil
+		return
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	r.limiter = &rateLimiter{
+		rate:   requestsPerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// shouldRetry decides if a request is attempted again after its response, or error
+func (p RetryPolicy) shouldRetry(method string, attempt int, code int, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	idempotent := method != http.MethodPost && method != http.MethodPatch
+	if err != nil {
+		// the request may have been processed before the connection failed
+		return idempotent || p.RetryNonIdempotent
+	}
+	if code == http.StatusTooManyRequests {
+		// the request was rejected before it was processed
+		for _, status := range p.RetryStatuses {
+			if status == code {
+				return true
+			}
+		}
+		return false
+	}
+	if !idempotent && !p.RetryNonIdempotent {
+		return false
+	}
+	for _, status := range p.RetryStatuses {
+		if status == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns how long to wait before the next attempt.
+// The server's Retry-After header is honored, if it was sent, up to MaxBackoff.
+func (p RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if wait, ok := retryAfter(resp); ok {
+		if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+			return p.MaxBackoff
+		}
+		return wait
+	}
+	delay := float64(p.MinBackoff) * math.Pow(2, float64(attempt-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	// equal jitter keeps at least half of the delay, so that the backoff still grows
+	return time.Duration(delay/2 + rand.Float64()*delay/2)
+}
+
+// retryAfter reads the Retry-After header of a response, in seconds or as a date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return time.Until(date), true
+	}
+	return 0, false
+}
+
+// sleep waits for the duration, or until the context is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimiter is a token bucket. It holds up to burst tokens, and is
+// refilled at rate tokens per second. Every request takes one token.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// wait blocks until a token is available, or the context is cancelled
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// reserve a token, going into debt if there are none left
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	return sleep(ctx, delay)
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyServer responds with the given status and headers to the first failures requests,
+// and with 200 OK after. It records the time of every request.
+type flakyServer struct {
+	mu       sync.Mutex
+	status   int
+	header   http.Header
+	failures int
+	requests []time.Time
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, time.Now())
+	if len(s.requests) <= s.failures {
+		for key, values := range s.header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(s.status)
+		w.Write([]byte(`{"message": "try again"}`))
+		return
+	}
+	w.Write([]byte(`{}`))
+}
+
+// client starts serving s, with a client that retries with policy. The caller closes the server.
+func (s *flakyServer) client(policy RetryPolicy) (*Client, *httptest.Server) {
+	srv := httptest.NewServer(s)
+	c := NewClient(srv.URL, "key", srv.Client())
+	c.SetRetryPolicy(policy)
+	return c, srv
+}
+
+// gap is the time between two requests
+func (s *flakyServer) gap(i int) time.Duration {
+	return s.requests[i].Sub(s.requests[i-1])
+}
+
+var bgContext = context.Background()
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:   3,
+	MinBackoff:    20 * time.Millisecond,
+	MaxBackoff:    time.Second,
+	RetryStatuses: DefaultRetryStatuses,
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			s := &flakyServer{status: status, failures: 1, header: http.Header{"Retry-After": {"1"}}}
+			c, srv := s.client(testRetryPolicy)
+			defer srv.Close()
+			if _, err := c.get(bgContext, "api/search", nil); err != nil {
+				t.Fatal(err)
+			}
+			if len(s.requests) != 2 {
+				t.Fatalf("got %d requests, want 2", len(s.requests))
+			}
+			// the backoff of the policy is much shorter, the server's delay is used instead
+			if gap := s.gap(1); gap < 950*time.Millisecond {
+				t.Errorf("retried after %s, want the 1s of Retry-After", gap)
+			}
+		})
+	}
+}
+
+func TestRetryAfterIsCapped(t *testing.T) {
+	policy := testRetryPolicy
+	policy.MaxBackoff = 50 * time.Millisecond
+	s := &flakyServer{status: http.StatusTooManyRequests, failures: 1, header: http.Header{"Retry-After": {"3600"}}}
+	c, srv := s.client(policy)
+	defer srv.Close()
+	if _, err := c.get(bgContext, "api/search", nil); err != nil {
+		t.Fatal(err)
+	}
+	if gap := s.gap(1); gap > 500*time.Millisecond {
+		t.Errorf("retried after %s, want at most the MaxBackoff of %s", gap, policy.MaxBackoff)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	date := &http.Response{Header: http.Header{"Retry-After": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}}}
+	tests := []struct {
+		name     string
+		attempt  int
+		resp     *http.Response
+		min, max time.Duration
+	}{
+		{name: "first retry", attempt: 1, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{name: "doubles", attempt: 2, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{name: "capped", attempt: 5, min: 150 * time.Millisecond, max: 300 * time.Millisecond},
+		{name: "Retry-After date is capped", attempt: 1, resp: date, min: 300 * time.Millisecond, max: 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				if d := policy.backoff(tt.attempt, tt.resp); d < tt.min || d > tt.max {
+					t.Fatalf("backoff %s, want between %s and %s", d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryServerErrors(t *testing.T) {
+	for _, status := range []int{http.StatusBadGateway, http.StatusGatewayTimeout} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			s := &flakyServer{status: status, failures: 10}
+			c, srv := s.client(testRetryPolicy)
+			defer srv.Close()
+			_, err := c.get(bgContext, "api/search", nil)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != status {
+				t.Fatalf("got error %v, want the %d of the last attempt", err, status)
+			}
+			if len(s.requests) != testRetryPolicy.MaxAttempts {
+				t.Fatalf("got %d requests, want MaxAttempts of %d", len(s.requests), testRetryPolicy.MaxAttempts)
+			}
+			// equal jitter keeps at least half of the backoff, which doubles
+			if gap := s.gap(1); gap < testRetryPolicy.MinBackoff/2 {
+				t.Errorf("first retry after %s, want at least %s", gap, testRetryPolicy.MinBackoff/2)
+			}
+			if gap := s.gap(2); gap < testRetryPolicy.MinBackoff {
+				t.Errorf("second retry after %s, want at least %s", gap, testRetryPolicy.MinBackoff)
+			}
+		})
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		nonIdempotent bool
+		want          int
+	}{
+		{name: "server error", status: http.StatusBadGateway, want: 1},
+		{name: "server error with RetryNonIdempotent", status: http.StatusBadGateway, nonIdempotent: true, want: 2},
+		// a request rejected with 429 was not processed, it is safe to repeat
+		{name: "too many requests", status: http.StatusTooManyRequests, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := testRetryPolicy
+			policy.RetryNonIdempotent = tt.nonIdempotent
+			s := &flakyServer{status: tt.status, failures: 1}
+			c, srv := s.client(policy)
+			defer srv.Close()
+			c.post(bgContext, "api/dashboards/db", nil, []byte(`{}`))
+			if len(s.requests) != tt.want {
+				t.Errorf("got %d requests, want %d", len(s.requests), tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := &flakyServer{}
+	c, srv := s.client(RetryPolicy{})
+	defer srv.Close()
+	c.SetRateLimit(20, 1)
+	for i := 0; i < 5; i++ {
+		if _, err := c.get(bgContext, "api/search", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 20 requests per second, without bursts, are 50ms apart
+	for i := 1; i < len(s.requests); i++ {
+		if gap := s.gap(i); gap < 40*time.Millisecond {
+			t.Errorf("request %d was %s after the one before, want at least 50ms", i, gap)
+		}
+	}
+}
@@ -1,9 +1,10 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"net/url"
+	"strconv"
 )
 
 // GrafanaSearchHit reflects the response of the folder/dashboard search API
@@ -15,33 +16,88 @@ type GrafanaSearchHit struct {
 	Type      string   `json:"type"`
 	Tags      []string `json:"tags"`
 	IsStarred bool     `json:"isStarred"`
+
+	FolderID    int64  `json:"folderId"`
+	FolderUID   string `json:"folderUid"`
+	FolderTitle string `json:"folderTitle"`
 }
 
 // Search searches grafana dashboards and folders
 // Reflects GET /api/search API call.
 func (r *Client) Search(queryParams url.Values) ([]GrafanaSearchHit, error) {
+	return r.SearchWithContext(context.Background(), queryParams)
+}
+
+// SearchWithContext is the same as Search, with a context to cancel the request.
+func (r *Client) SearchWithContext(ctx context.Context, queryParams url.Values) ([]GrafanaSearchHit, error) {
 	var (
 		raw   []byte
-		code  int
 		found []GrafanaSearchHit
 		err   error
 	)
-	if raw, code, err = r.get("api/search", queryParams); err != nil {
+	if raw, err = r.get(ctx, "api/search", queryParams); err != nil {
 		return nil, err
 	}
-	if code != 200 {
-		return nil, fmt.Errorf("HTTP error %d: returns %s", code, raw)
-	}
 	err = json.Unmarshal(raw, &found)
 	return found, err
 }
 
 func (r *Client) SearchFolders(queryParams url.Values) ([]GrafanaSearchHit, error) {
+	return r.SearchFoldersWithContext(context.Background(), queryParams)
+}
+
+// SearchFoldersWithContext is the same as SearchFolders, with a context to cancel the request.
+func (r *Client) SearchFoldersWithContext(ctx context.Context, queryParams url.Values) ([]GrafanaSearchHit, error) {
 	queryParams.Set("type", "dash-folder")
-	return r.Search(queryParams)
+	return r.SearchWithContext(ctx, queryParams)
 }
 
 func (r *Client) SearchDashboards(queryParams url.Values) ([]GrafanaSearchHit, error) {
+	return r.SearchDashboardsWithContext(context.Background(), queryParams)
+}
+
+// SearchDashboardsWithContext is the same as SearchDashboards, with a context to cancel the request.
+func (r *Client) SearchDashboardsWithContext(ctx context.Context, queryParams url.Values) ([]GrafanaSearchHit, error) {
 	queryParams.Set("type", "dash-db")
-	return r.Search(queryParams)
+	return r.SearchWithContext(ctx, queryParams)
+}
+
+// searchPageSize is the number of hits requested at once, grafana returns 1000 by default
+const searchPageSize = 1000
+
+// SearchAllDashboards searches grafana dashboards, and gets every page of the results
+// instead of the first page only. The limit and page parameters are set for each page.
+// Reflects GET /api/search API call.
+func (r *Client) SearchAllDashboards(queryParams url.Values) ([]GrafanaSearchHit, error) {
+	return r.SearchAllDashboardsWithContext(context.Background(), queryParams)
+}
+
+// SearchAllDashboardsWithContext is the same as SearchAllDashboards, with a context to cancel the request.
+func (r *Client) SearchAllDashboardsWithContext(ctx context.Context, queryParams url.Values) ([]GrafanaSearchHit, error) {
+	var found []GrafanaSearchHit
+	seen := map[string]bool{}
+	for page := 1; ; page++ {
+		params := url.Values{}
+		for key, values := range queryParams {
+			params[key] = values
+		}
+		params.Set("limit", strconv.Itoa(searchPageSize))
+		params.Set("page", strconv.Itoa(page))
+		results, err := r.SearchDashboardsWithContext(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		added := 0
+		for _, hit := range results {
+			if !seen[hit.UID] {
+				seen[hit.UID] = true
+				found = append(found, hit)
+				added++
+			}
+		}
+		// older versions of grafana ignore page, and return the same hits again
+		if len(results) < searchPageSize || added == 0 {
+			return found, nil
+		}
+	}
 }
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestSearchAllDashboards(t *testing.T) {
+	var hits []GrafanaSearchHit
+	for i := 0; i < 2*searchPageSize+1; i++ {
+		hits = append(hits, GrafanaSearchHit{UID: fmt.Sprintf("d%d", i), Type: "dash-db"})
+	}
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		query := r.URL.Query()
+		if query.Get("type") != "dash-db" || query.Get("tag") != "prod" {
+			t.Errorf("the search parameters were not kept: %s", r.URL)
+		}
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		page, _ := strconv.Atoi(query.Get("page"))
+		if limit == 0 || page == 0 {
+			t.Fatalf("dashboards searched without a page: %s", r.URL)
+		}
+		start, end := (page-1)*limit, page*limit
+		if start > len(hits) {
+			start = len(hits)
+		}
+		if end > len(hits) {
+			end = len(hits)
+		}
+		json.NewEncoder(w).Encode(hits[start:end])
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, "key", srv.Client())
+
+	query := url.Values{}
+	query.Set("tag", "prod")
+	found, err := c.SearchAllDashboards(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != len(hits) {
+		t.Fatalf("got %d dashboards, want %d", len(found), len(hits))
+	}
+	for i, hit := range found {
+		if hit.UID != hits[i].UID {
+			t.Fatalf("got %s at %d, want %s", hit.UID, i, hits[i].UID)
+		}
+	}
+	if requests != 3 {
+		t.Errorf("got %d requests, want 3 pages", requests)
+	}
+	if query.Get("page") != "" {
+		t.Errorf("the query of the caller was changed: %s", query.Encode())
+	}
+}
+
+func TestSearchAllDashboardsIgnoredPage(t *testing.T) {
+	var hits []GrafanaSearchHit
+	for i := 0; i < searchPageSize+1; i++ {
+		hits = append(hits, GrafanaSearchHit{UID: fmt.Sprintf("d%d", i), Type: "dash-db"})
+	}
+	requests := 0
+	// older versions of grafana ignore page, and return the same hits each time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > 3 {
+			t.Errorf("the same dashboards were searched %d times", requests)
+			w.Write([]byte("[]"))
+			return
+		}
+		json.NewEncoder(w).Encode(hits)
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, "key", srv.Client())
+
+	found, err := c.SearchAllDashboards(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != len(hits) {
+		t.Errorf("got %d dashboards, want %d", len(found), len(hits))
+	}
+	if requests != 2 {
+		t.Errorf("got %d requests, want to stop at the first repeated page", requests)
+	}
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// GrafanaDashboardVersion is a saved version of a dashboard
+type GrafanaDashboardVersion struct {
+	ID            int64     `json:"id"`
+	DashboardID   int64     `json:"dashboardId"`
+	ParentVersion int       `json:"parentVersion"`
+	RestoredFrom  int       `json:"restoredFrom"`
+	Version       int       `json:"version"`
+	Created       time.Time `json:"created"`
+	CreatedBy     string    `json:"createdBy"`
+	Message       string    `json:"message"`
+	// Data is the dashboard at this version, it is only set by GetDashboardVersion
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// GetDashboardVersions gets the versions of the dashboard with the given ID, newest first.
+// At most limit versions are returned, grafana's default is used for 0.
+// Reflects GET /api/dashboards/id/:dashboardId/versions API call.
+func (r *Client) GetDashboardVersions(dashboardID int64, limit int) ([]GrafanaDashboardVersion, error) {
+	return r.GetDashboardVersionsWithContext(context.Background(), dashboardID, limit)
+}
+
+// GetDashboardVersionsWithContext is the same as GetDashboardVersions, with a context to cancel the request.
+func (r *Client) GetDashboardVersionsWithContext(ctx context.Context, dashboardID int64, limit int) ([]GrafanaDashboardVersion, error) {
+	var versions []GrafanaDashboardVersion
+	params := url.Values{}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	raw, err := r.get(ctx, fmt.Sprintf("api/dashboards/id/%d/versions", dashboardID), params)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(raw, &versions)
+	return versions, err
+}
+
+// GetDashboardVersion gets a version of the dashboard with the given ID, including the dashboard at that version.
+// Reflects GET /api/dashboards/id/:dashboardId/versions/:version API call.
+func (r *Client) GetDashboardVersion(dashboardID int64, version int) (GrafanaDashboardVersion, error) {
+	return r.GetDashboardVersionWithContext(context.Background(), dashboardID, version)
+}
+
+// GetDashboardVersionWithContext is the same as GetDashboardVersion, with a context to cancel the request.
+func (r *Client) GetDashboardVersionWithContext(ctx context.Context, dashboardID int64, version int) (GrafanaDashboardVersion, error) {
+	var v GrafanaDashboardVersion
+	raw, err := r.get(ctx, fmt.Sprintf("api/dashboards/id/%d/versions/%d", dashboardID, version), nil)
+	if err != nil {
+		return v, err
+	}
+	err = json.Unmarshal(raw, &v)
+	return v, err
+}
+
+// RestoreDashboardVersion saves a previous version of the dashboard with the given ID as its newest version.
+// Returns the new version of the dashboard.
+// Reflects POST /api/dashboards/id/:dashboardId/restore API call.
+func (r *Client) RestoreDashboardVersion(dashboardID int64, version int) (int, error) {
+	return r.RestoreDashboardVersionWithContext(context.Background(), dashboardID, version)
+}
+
+// RestoreDashboardVersionWithContext is the same as RestoreDashboardVersion, with a context to cancel the request.
+func (r *Client) RestoreDashboardVersionWithContext(ctx context.Context, dashboardID int64, version int) (int, error) {
+	var restored struct {
+		Version int `json:"version"`
+	}
+	payload, _ := json.Marshal(map[string]int{"version": version})
+	raw, err := r.post(ctx, fmt.Sprintf("api/dashboards/id/%d/restore", dashboardID), nil, payload)
+	if err != nil {
+		return 0, err
+	}
+	err = json.Unmarshal(raw, &restored)
+	return restored.Version, err
+}
@@ -0,0 +1,141 @@
+package dashboard
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DataSourceRef is a reference from a dashboard to a datasource. Dashboards
+// reference datasources by name, or since grafana 8.3 by UID and type.
+type DataSourceRef struct {
+	Name string
+	UID  string
+	Type string
+}
+
+func (r DataSourceRef) String() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.UID
+}
+
+// DataSourceResolver returns the reference that replaces ref, or false if it can't be resolved
+type DataSourceResolver func(ref DataSourceRef) (DataSourceRef, bool)
+
+// UnresolvedDataSource is a datasource reference of a dashboard that couldn't be resolved
+type UnresolvedDataSource struct {
+	// Path is the location of the reference in the dashboard, e.g. panels[0].targets[1].datasource
+	Path string
+	Ref  DataSourceRef
+}
+
+func (u UnresolvedDataSource) String() string {
+	return fmt.Sprintf("%s: datasource '%s' was not found", u.Path, u.Ref)
+}
+
+// builtinDataSources are provided by grafana itself, and exist on every instance
+var builtinDataSources = map[string]bool{
+	"default":         true,
+	"grafana":         true,
+	"-- Grafana --":   true,
+	"-- Mixed --":     true,
+	"-- Dashboard --": true,
+}
+
+// RewriteDataSources replaces the datasource references of the panels, queries, templating
+// variables and annotations of a dashboard with the references returned by resolve.
+// References to the default datasource, to built-in datasources and to variables are left as they are.
+// Returns the references that couldn't be resolved, which are left as they are as well.
+func RewriteDataSources(dash map[string]interface{}, resolve DataSourceResolver) []UnresolvedDataSource {
+	var unresolved []UnresolvedDataSource
+	rewrite := func(path string, item map[string]interface{}) {
+		ref, ok := parseDataSourceRef(item["datasource"])
+		if !ok {
+			return
+		}
+		resolved, ok := resolve(ref)
+		if !ok {
+			unresolved = append(unresolved, UnresolvedDataSource{Path: path + ".datasource", Ref: ref})
+			return
+		}
+		item["datasource"] = formatDataSourceRef(item["datasource"], resolved)
+	}
+
+	var walkPanels func(path string, list interface{})
+	walkPanels = func(path string, list interface{}) {
+		for i, panel := range objects(list) {
+			panelPath := fmt.Sprintf("%s[%d]", path, i)
+			rewrite(panelPath, panel)
+			for j, target := range objects(panel["targets"]) {
+				rewrite(fmt.Sprintf("%s.targets[%d]", panelPath, j), target)
+			}
+			// the panels of collapsed rows are nested in the row
+			walkPanels(panelPath+".panels", panel["panels"])
+		}
+	}
+	walkPanels("panels", dash["panels"])
+	// dashboards from before grafana 5 hold their panels in rows
+	for i, row := range objects(dash["rows"]) {
+		walkPanels(fmt.Sprintf("rows[%d].panels", i), row["panels"])
+	}
+	for _, section := range []string{"templating", "annotations"} {
+		parent, _ := dash[section].(map[string]interface{})
+		for i, item := range objects(parent["list"]) {
+			rewrite(fmt.Sprintf("%s.list[%d]", section, i), item)
+		}
+	}
+	return unresolved
+}
+
+// parseDataSourceRef reads a datasource reference, which is either a name or an object
+// with a UID and type. False is returned for references that are not rewritten.
+func parseDataSourceRef(value interface{}) (DataSourceRef, bool) {
+	var ref DataSourceRef
+	switch v := value.(type) {
+	case string:
+		ref.Name = v
+	case map[string]interface{}:
+		ref.UID, _ = v["uid"].(string)
+		ref.Type, _ = v["type"].(string)
+		if ref.Type == "datasource" {
+			return ref, false
+		}
+	default:
+		return ref, false
+	}
+	name := ref.String()
+	if name == "" || strings.HasPrefix(name, "$") || builtinDataSources[name] {
+		return ref, false
+	}
+	return ref, true
+}
+
+// formatDataSourceRef writes a resolved reference in the same form as the original
+func formatDataSourceRef(original interface{}, ref DataSourceRef) interface{} {
+	v, ok := original.(map[string]interface{})
+	if !ok {
+		return ref.String()
+	}
+	rewritten := map[string]interface{}{}
+	for key, value := range v {
+		rewritten[key] = value
+	}
+	rewritten["uid"] = ref.UID
+	if ref.Type != "" {
+		rewritten["type"] = ref.Type
+	}
+	return rewritten
+}
+
+// objects returns the objects of a decoded JSON array
+func objects(list interface{}) []map[string]interface{} {
+	items, _ := list.([]interface{})
+	result := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if obj, ok := item.(map[string]interface{}); ok {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
@@ -0,0 +1,111 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ChangeKind describes how a value differs between two documents
+type ChangeKind string
+
+// Kinds of changes found by Diff
+const (
+	Added    ChangeKind = "+"
+	Removed  ChangeKind = "-"
+	Modified ChangeKind = "~"
+)
+
+// Change is a single difference between two JSON documents
+type Change struct {
+	Path string
+	Kind ChangeKind
+	From interface{}
+	To   interface{}
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("%s %s: %s", c.Kind, c.Path, encodeValue(c.To))
+	case Removed:
+		return fmt.Sprintf("%s %s: %s", c.Kind, c.Path, encodeValue(c.From))
+	default:
+		return fmt.Sprintf("%s %s: %s -> %s", c.Kind, c.Path, encodeValue(c.From), encodeValue(c.To))
+	}
+}
+
+// Diff walks two decoded JSON documents and returns every value that differs
+// between them. Object keys are visited in sorted order, and arrays are
+// compared index by index, so the result is stable.
+func Diff(from, to interface{}) []Change {
+	return diffValues("", from, to, nil)
+}
+
+func diffValues(path string, from, to interface{}, changes []Change) []Change {
+	switch fromTyped := from.(type) {
+	case map[string]interface{}:
+		toTyped, ok := to.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(fromTyped)+len(toTyped))
+		for key := range fromTyped {
+			keys = append(keys, key)
+		}
+		for key := range toTyped {
+			if _, ok := fromTyped[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			fromValue, inFrom := fromTyped[key]
+			toValue, inTo := toTyped[key]
+			switch {
+			case !inFrom:
+				changes = append(changes, Change{Path: keyPath, Kind: Added, To: toValue})
+			case !inTo:
+				changes = append(changes, Change{Path: keyPath, Kind: Removed, From: fromValue})
+			default:
+				changes = diffValues(keyPath, fromValue, toValue, changes)
+			}
+		}
+		return changes
+	case []interface{}:
+		toTyped, ok := to.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(fromTyped) || i < len(toTyped); i++ {
+			indexPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(fromTyped):
+				changes = append(changes, Change{Path: indexPath, Kind: Added, To: toTyped[i]})
+			case i >= len(toTyped):
+				changes = append(changes, Change{Path: indexPath, Kind: Removed, From: fromTyped[i]})
+			default:
+				changes = diffValues(indexPath, fromTyped[i], toTyped[i], changes)
+			}
+		}
+		return changes
+	}
+	if !reflect.DeepEqual(from, to) {
+		changes = append(changes, Change{Path: path, Kind: Modified, From: from, To: to})
+	}
+	return changes
+}
+
+// encodeValue renders a value the way it appears in JSON
+func encodeValue(value interface{}) string {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(raw)
+}
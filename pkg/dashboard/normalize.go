@@ -0,0 +1,126 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// DefaultStrip are the fields that are specific to a grafana instance, or change on every save
+var DefaultStrip = []string{"id", "version", "iteration"}
+
+// NormalizeOptions controls how a dashboard is normalized
+type NormalizeOptions struct {
+	// Strip are the fields to remove, as dot separated paths from the top of the dashboard.
+	// A * matches every value of an object, or every item of a list, e.g. panels.*.pluginVersion
+	Strip []string
+	// RenumberPanels numbers the panels from 1 in the order they appear, including the panels of rows
+	RenumberPanels bool
+}
+
+// Normalize removes the stripped fields of a dashboard, and renumbers its panels if enabled.
+// The dashboard is changed in place.
+func Normalize(dash map[string]interface{}, opts NormalizeOptions) {
+	for _, rule := range opts.Strip {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			strip(dash, strings.Split(rule, "."))
+		}
+	}
+	if opts.RenumberPanels {
+		renumberPanels(dash)
+	}
+}
+
+// Format encodes a dashboard as indented JSON, with sorted keys and a trailing newline.
+// Unlike json.MarshalIndent, <, > and & are kept as they are, they are common in queries.
+func Format(dash map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(dash); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode reads a dashboard, keeping numbers as they are written
+func Decode(raw []byte) (map[string]interface{}, error) {
+	var dash map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&dash); err != nil {
+		return nil, err
+	}
+	return dash, nil
+}
+
+// strip removes the field at path from value
+func strip(value interface{}, path []string) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			delete(typed, path[0])
+			return
+		}
+		if path[0] == "*" {
+			for _, item := range typed {
+				strip(item, path[1:])
+			}
+			return
+		}
+		strip(typed[path[0]], path[1:])
+	case []interface{}:
+		// fields are only removed from objects, so items of a list are always walked
+		if path[0] != "*" || len(path) == 1 {
+			return
+		}
+		for _, item := range typed {
+			strip(item, path[1:])
+		}
+	}
+}
+
+// renumberPanels gives the panels of a dashboard sequential IDs, and updates
+// the references of repeated panels and of queries of the dashboard datasource
+func renumberPanels(dash map[string]interface{}) {
+	panels := Panels(dash)
+	ids := make(map[string]int, len(panels))
+	for i, panel := range panels {
+		if id, ok := panel["id"]; ok {
+			ids[panelID(id)] = i + 1
+		}
+		panel["id"] = i + 1
+	}
+	for _, panel := range panels {
+		if id, ok := ids[panelID(panel["repeatPanelId"])]; ok {
+			panel["repeatPanelId"] = id
+		}
+		targets, _ := panel["targets"].([]interface{})
+		for _, item := range targets {
+			target, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if id, ok := ids[panelID(target["panelId"])]; ok {
+				target["panelId"] = id
+			}
+		}
+	}
+}
+
+// panelID returns a panel ID as a string, whether it was decoded as a number or not
+func panelID(id interface{}) string {
+	switch typed := id.(type) {
+	case nil:
+		return ""
+	case json.Number:
+		return typed.String()
+	case float64:
+		raw, _ := json.Marshal(typed)
+		return string(raw)
+	default:
+		raw, _ := json.Marshal(typed)
+		return strings.Trim(string(raw), `"`)
+	}
+}
@@ -0,0 +1,79 @@
+package dashboard
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// PanelChanges lists the titles of panels that differ between two dashboards
+type PanelChanges struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Empty is true when both dashboards have the same panels
+func (p PanelChanges) Empty() bool {
+	return len(p.Added) == 0 && len(p.Removed) == 0 && len(p.Changed) == 0
+}
+
+// DiffPanels compares the panels of two dashboards, matching them by title.
+// Panels nested in rows are compared as well.
+func DiffPanels(from, to map[string]interface{}) PanelChanges {
+	var changes PanelChanges
+	fromPanels := panelsByTitle(from)
+	toPanels := panelsByTitle(to)
+	for title, fromPanel := range fromPanels {
+		toPanel, ok := toPanels[title]
+		if !ok {
+			changes.Removed = append(changes.Removed, title)
+		} else if !reflect.DeepEqual(fromPanel, toPanel) {
+			changes.Changed = append(changes.Changed, title)
+		}
+	}
+	for title := range toPanels {
+		if _, ok := fromPanels[title]; !ok {
+			changes.Added = append(changes.Added, title)
+		}
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Removed)
+	sort.Strings(changes.Changed)
+	return changes
+}
+
+// Panels returns every panel of a dashboard, including the panels of collapsed rows
+func Panels(dash map[string]interface{}) []map[string]interface{} {
+	return appendPanels(nil, dash["panels"])
+}
+
+func appendPanels(panels []map[string]interface{}, list interface{}) []map[string]interface{} {
+	items, _ := list.([]interface{})
+	for _, item := range items {
+		panel, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		panels = append(panels, panel)
+		panels = appendPanels(panels, panel["panels"])
+	}
+	return panels
+}
+
+// panelsByTitle indexes the panels of a dashboard by their title.
+// Untitled panels, and panels sharing a title, are told apart by their position.
+func panelsByTitle(dash map[string]interface{}) map[string]map[string]interface{} {
+	indexed := map[string]map[string]interface{}{}
+	for i, panel := range Panels(dash) {
+		title, _ := panel["title"].(string)
+		if title == "" {
+			title = fmt.Sprintf("untitled panel #%d", i+1)
+		}
+		if _, exists := indexed[title]; exists {
+			title = fmt.Sprintf("%s #%d", title, i+1)
+		}
+		indexed[title] = panel
+	}
+	return indexed
+}
@@ -0,0 +1,146 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Input is an input of a dashboard exported for sharing externally.
+// Grafana replaces the ${NAME} placeholders of an input with its value on import.
+type Input struct {
+	Name        string `json:"name"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	PluginID    string `json:"pluginId,omitempty"`
+	PluginName  string `json:"pluginName,omitempty"`
+	// Value is the default value of a constant input
+	Value string `json:"value,omitempty"`
+}
+
+// ExportedDataSource is a datasource referenced by a dashboard exported for sharing externally
+type ExportedDataSource struct {
+	Name string
+	// Type is the ID of the plugin of the datasource, and TypeName its name
+	Type     string
+	TypeName string
+}
+
+// portableSections are added to a dashboard exported for sharing externally, and removed on import
+var portableSections = []string{"__inputs", "__requires", "__elements"}
+
+var inputNameRegex = regexp.MustCompile("[^A-Z0-9]+")
+
+// MakePortable converts a dashboard to the format of grafana's "Export for sharing externally".
+// Datasource references become ${DS_NAME} placeholders of inputs, listed in __inputs, and the
+// datasource and panel plugins, and the version of grafana if known, are listed in __requires.
+// The dashboard is changed in place. Returns the references lookup couldn't find, which are left as they are.
+func MakePortable(dash map[string]interface{}, lookup func(ref DataSourceRef) (ExportedDataSource, bool), grafanaVersion string) []UnresolvedDataSource {
+	inputs := map[string]map[string]interface{}{}
+	requires := map[string]map[string]interface{}{}
+	unresolved := RewriteDataSources(dash, func(ref DataSourceRef) (DataSourceRef, bool) {
+		ds, ok := lookup(ref)
+		if !ok {
+			return ref, false
+		}
+		name := "DS_" + strings.Trim(inputNameRegex.ReplaceAllString(strings.ToUpper(ds.Name), "_"), "_")
+		pluginName := ds.TypeName
+		if pluginName == "" {
+			pluginName = ds.Type
+		}
+		inputs[name] = map[string]interface{}{
+			"name":        name,
+			"label":       ds.Name,
+			"description": "",
+			"type":        "datasource",
+			"pluginId":    ds.Type,
+			"pluginName":  pluginName,
+		}
+		requires["datasource/"+ds.Type] = requirement("datasource", ds.Type, pluginName, "")
+		placeholder := "${" + name + "}"
+		return DataSourceRef{Name: placeholder, UID: placeholder, Type: ds.Type}, true
+	})
+	for _, panel := range Panels(dash) {
+		if panelType, _ := panel["type"].(string); panelType != "" && panelType != "row" {
+			requires["panel/"+panelType] = requirement("panel", panelType, panelType, "")
+		}
+	}
+	if grafanaVersion != "" {
+		requires["grafana"] = requirement("grafana", "grafana", "Grafana", grafanaVersion)
+	}
+
+	dash["__inputs"] = sortedObjects(inputs)
+	dash["__requires"] = sortedObjects(requires)
+	return unresolved
+}
+
+// Inputs returns the inputs of a dashboard exported for sharing externally, nil for other dashboards
+func Inputs(dash map[string]interface{}) []Input {
+	if dash["__inputs"] == nil {
+		return nil
+	}
+	var inputs []Input
+	raw, _ := json.Marshal(dash["__inputs"])
+	_ = json.Unmarshal(raw, &inputs)
+	return inputs
+}
+
+// ResolveInputs returns a dashboard exported for sharing externally the way grafana imports it:
+// the placeholders of inputs are replaced with values, and the sections of the export are removed.
+// The exported dashboard is not changed.
+func ResolveInputs(dash map[string]interface{}, values map[string]string) map[string]interface{} {
+	var resolved map[string]interface{}
+	raw, _ := json.Marshal(dash)
+	_ = json.Unmarshal(raw, &resolved)
+	for _, section := range portableSections {
+		delete(resolved, section)
+	}
+	replacements := make([]string, 0, 2*len(values))
+	for name, value := range values {
+		replacements = append(replacements, "${"+name+"}", value)
+	}
+	replacer := strings.NewReplacer(replacements...)
+	for key, value := range resolved {
+		resolved[key] = replaceStrings(value, replacer)
+	}
+	return resolved
+}
+
+func replaceStrings(value interface{}, replacer *strings.Replacer) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key] = replaceStrings(item, replacer)
+		}
+		return typed
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = replaceStrings(item, replacer)
+		}
+		return typed
+	case string:
+		return replacer.Replace(typed)
+	default:
+		return value
+	}
+}
+
+func requirement(kind, id, name, version string) map[string]interface{} {
+	return map[string]interface{}{"type": kind, "id": id, "name": name, "version": version}
+}
+
+// sortedObjects returns the values of a map, sorted by key
+func sortedObjects(objects map[string]map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	list := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, objects[key])
+	}
+	return list
+}
@@ -0,0 +1,28 @@
+package dashboard
+
+import (
+	"encoding/json"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// UnifiedDiff renders two dashboards as indented JSON, and returns the
+// differences between them in the unified diff format.
+// An empty string is returned when the dashboards are the same.
+func UnifiedDiff(from, to map[string]interface{}, fromName, toName string) (string, error) {
+	fromRaw, err := json.MarshalIndent(from, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	toRaw, err := json.MarshalIndent(to, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(fromRaw) + "\n"),
+		B:        difflib.SplitLines(string(toRaw) + "\n"),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+}
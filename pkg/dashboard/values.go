@@ -0,0 +1,83 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// placeholderPattern matches the placeholders of values, like {{values.cluster}} or {{ values.alerts.threshold }}.
+// Unlike ${var} or {{label}}, it doesn't clash with grafana variables or legend formats.
+var placeholderPattern = regexp.MustCompile(`\{\{\s*values\.([A-Za-z0-9_-]+(?:\.[A-Za-z0-9_-]+)*)\s*\}\}`)
+
+// RenderValues replaces the placeholders in the strings of a dashboard with values,
+// which are looked up by their dot separated path. A string that is a single placeholder
+// is replaced by the value itself, so that numbers and booleans keep their type.
+// The dashboard is changed in place. Returns the sorted paths of the values that are not defined.
+func RenderValues(dash map[string]interface{}, values map[string]interface{}) []string {
+	undefined := map[string]bool{}
+	for key, value := range dash {
+		dash[key] = renderValue(value, values, undefined)
+	}
+	paths := make([]string, 0, len(undefined))
+	for path := range undefined {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func renderValue(value interface{}, values map[string]interface{}, undefined map[string]bool) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key] = renderValue(item, values, undefined)
+		}
+		return typed
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = renderValue(item, values, undefined)
+		}
+		return typed
+	case string:
+		if match := placeholderPattern.FindStringSubmatch(typed); match != nil && match[0] == typed {
+			replacement, ok := lookupValue(values, match[1])
+			if !ok {
+				undefined[match[1]] = true
+				return typed
+			}
+			return replacement
+		}
+		return placeholderPattern.ReplaceAllStringFunc(typed, func(placeholder string) string {
+			path := placeholderPattern.FindStringSubmatch(placeholder)[1]
+			replacement, ok := lookupValue(values, path)
+			if !ok {
+				undefined[path] = true
+				return placeholder
+			}
+			if s, ok := replacement.(string); ok {
+				return s
+			}
+			raw, _ := json.Marshal(replacement)
+			return string(raw)
+		})
+	default:
+		return value
+	}
+}
+
+// lookupValue finds a value by its dot separated path
+func lookupValue(values map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = values
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
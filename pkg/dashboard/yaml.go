@@ -0,0 +1,102 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+)
+
+// YAMLToJSON converts the documents of a YAML file to JSON, one per document.
+// Empty documents are skipped.
+func YAMLToJSON(raw []byte) ([][]byte, error) {
+	var docs [][]byte
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	for {
+		var doc interface{}
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			continue
+		}
+		converted, err := json.Marshal(jsonValue(doc))
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", len(docs)+1, err)
+		}
+		docs = append(docs, converted)
+	}
+}
+
+// FormatYAML encodes documents as a YAML file, with sorted keys.
+// Documents are separated by ---, when there is more than one.
+func FormatYAML(docs ...map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, doc := range docs {
+		raw, err := yaml.Marshal(yamlValue(doc))
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(raw)
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonValue converts a decoded YAML value to one that can be encoded as JSON.
+// YAML allows keys of any type, JSON only strings.
+func jsonValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			converted[fmt.Sprintf("%v", key)] = jsonValue(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(typed))
+		for i, item := range typed {
+			converted[i] = jsonValue(item)
+		}
+		return converted
+	default:
+		return value
+	}
+}
+
+// yamlValue converts a decoded JSON value to one that is encoded the same way as YAML.
+// Numbers decoded as json.Number would be quoted as strings otherwise.
+func yamlValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			converted[key] = yamlValue(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(typed))
+		for i, item := range typed {
+			converted[i] = yamlValue(item)
+		}
+		return converted
+	case json.Number:
+		if i, err := typed.Int64(); err == nil {
+			return i
+		}
+		if f, err := typed.Float64(); err == nil {
+			return f
+		}
+		return typed.String()
+	default:
+		return value
+	}
+}
@@ -0,0 +1,240 @@
+// Package printer prints lists of grafana resources in the formats of the --output flag.
+//
+// A resource type only has to implement List to be printed in every format.
+package printer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/oliveagle/jsonpath"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats are the names of the supported output formats
+var Formats = []string{"table", "wide", "json", "yaml", "name", "template", "jsonpath"}
+
+// Column is a column of the table printed for a list
+type Column struct {
+	Header string
+	// Wide columns are only printed by the wide format
+	Wide bool
+}
+
+// List is a list of resources, and how to print them as a table
+type List interface {
+	// Columns returns the columns of the table
+	Columns() []Column
+	// Len returns the number of resources in the list
+	Len() int
+	// Row returns the cells of the i'th resource, one for every column
+	Row(i int) []string
+	// Name returns the name of the i'th resource, as printed by the name format
+	Name(i int) string
+	// Items returns the resources, as printed by the json, yaml, template and jsonpath formats
+	Items() interface{}
+}
+
+// Printer prints a list in one of the output formats
+type Printer interface {
+	Print(w io.Writer, list List) error
+}
+
+// New returns the printer of an output format.
+// The template and jsonpath formats take their expression after an '=', as in
+// "jsonpath=$[*].uid", or from the tmpl argument.
+func New(format string, tmpl string) (Printer, error) {
+	if i := strings.Index(format, "="); i >= 0 {
+		format, tmpl = format[:i], format[i+1:]
+	}
+	switch format {
+	case "", "table":
+		return tablePrinter{}, nil
+	case "wide":
+		return tablePrinter{wide: true}, nil
+	case "json":
+		return jsonPrinter{}, nil
+	case "yaml":
+		return yamlPrinter{}, nil
+	case "name":
+		return namePrinter{}, nil
+	case "template", "go-template":
+		if tmpl == "" {
+			return nil, fmt.Errorf("the %s format requires a template", format)
+		}
+		t, err := template.New("output").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		return templatePrinter{template: t}, nil
+	case "jsonpath":
+		if tmpl == "" {
+			return nil, fmt.Errorf("the jsonpath format requires an expression")
+		}
+		path, err := jsonpath.Compile(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jsonpath expression: %w", err)
+		}
+		return jsonPathPrinter{path: path}, nil
+	}
+	return nil, fmt.Errorf("unknown output format '%s', must be one of: %s", format, strings.Join(Formats, ", "))
+}
+
+// tablePrinter prints a list as a table, the default format
+type tablePrinter struct {
+	wide bool
+}
+
+func (p tablePrinter) Print(w io.Writer, list List) error {
+	if list.Len() == 0 {
+		_, err := fmt.Fprintln(w, "No results found.")
+		return err
+	}
+	columns := list.Columns()
+	var headers []string
+	for _, column := range columns {
+		if p.wide || !column.Wide {
+			headers = append(headers, column.Header)
+		}
+	}
+	table := tablewriter.NewWriter(w)
+	table.SetHeader(headers)
+	for i := 0; i < list.Len(); i++ {
+		var cells []string
+		for j, cell := range list.Row(i) {
+			if p.wide || !columns[j].Wide {
+				cells = append(cells, cell)
+			}
+		}
+		table.Append(cells)
+	}
+	table.Render()
+	return nil
+}
+
+// namePrinter prints the name of every resource on its own line
+type namePrinter struct{}
+
+func (namePrinter) Print(w io.Writer, list List) error {
+	for i := 0; i < list.Len(); i++ {
+		if _, err := fmt.Fprintln(w, list.Name(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type jsonPrinter struct{}
+
+func (jsonPrinter) Print(w io.Writer, list List) error {
+	data, err := genericItems(list)
+	if err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", raw)
+	return err
+}
+
+type yamlPrinter struct{}
+
+func (yamlPrinter) Print(w io.Writer, list List) error {
+	data, err := genericItems(list)
+	if err != nil {
+		return err
+	}
+	raw, err := yaml.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(raw)
+	return err
+}
+
+// templatePrinter executes a go template with the list of resources
+type templatePrinter struct {
+	template *template.Template
+}
+
+func (p templatePrinter) Print(w io.Writer, list List) error {
+	data, err := genericItems(list)
+	if err != nil {
+		return err
+	}
+	return p.template.Execute(w, data)
+}
+
+// jsonPathPrinter prints the result of a jsonpath expression on the list of resources.
+// Every value of a list of results is printed on its own line.
+type jsonPathPrinter struct {
+	path *jsonpath.Compiled
+}
+
+func (p jsonPathPrinter) Print(w io.Writer, list List) error {
+	data, err := genericItems(list)
+	if err != nil {
+		return err
+	}
+	result, err := p.path.Lookup(data)
+	if err != nil {
+		return err
+	}
+	values, ok := result.([]interface{})
+	if !ok {
+		values = []interface{}{result}
+	}
+	for _, value := range values {
+		if err = printValue(w, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printValue prints a scalar as is, and anything else as JSON
+func printValue(w io.Writer, value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}, []interface{}:
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", raw)
+		return err
+	case float64:
+		// JSON numbers are decoded as floats, don't print IDs in exponent notation
+		_, err := fmt.Fprintln(w, strconv.FormatFloat(v, 'f', -1, 64))
+		return err
+	case nil:
+		_, err := fmt.Fprintln(w)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%v\n", value)
+	return err
+}
+
+// genericItems returns the items of a list as they are encoded to JSON, so that
+// every format uses the same field names as the grafana API.
+func genericItems(list List) (interface{}, error) {
+	raw, err := json.Marshal(list.Items())
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	if err = json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+	// an empty list is still a list
+	if data == nil {
+		data = []interface{}{}
+	}
+	return data, nil
+}